@@ -47,6 +47,49 @@ func main() {
 		Short: "Delete resources",
 	}
 
+	//create
+	createCmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create resources",
+	}
+
+	//cronjob
+	cronjobCmd := &cobra.Command{
+		Use:     "cronjob",
+		Aliases: []string{"cronjobs", "cj"},
+		Short:   "Manage scheduled tasks",
+	}
+
+	//drain
+	drainCmd := &cobra.Command{
+		Use:   "drain",
+		Short: "Drain resources",
+	}
+	undrainCmd := &cobra.Command{
+		Use:   "undrain",
+		Short: "Undrain resources",
+	}
+
+	//nodes
+	nodesCmd := &cobra.Command{
+		Use:     "nodes",
+		Aliases: []string{"node"},
+		Short:   "Maintain container instances",
+	}
+
+	//capacity
+	capacityCmd := &cobra.Command{
+		Use:   "capacity",
+		Short: "Check cluster capacity",
+	}
+
+	//autoscale
+	autoscaleCmd := &cobra.Command{
+		Use:     "autoscale",
+		Aliases: []string{"as"},
+		Short:   "Manage service autoscaling",
+	}
+
 	//deploy
 
 	//login
@@ -55,15 +98,31 @@ func main() {
 	getCmd.AddCommand(ecs.ListClusters())
 	describeCmd.AddCommand(ecs.DescribeCluster())
 	deleteCmd.AddCommand(ecs.DeleteCluster())
+	createCmd.AddCommand(ecs.CreateCluster())
+
+	//capacity providers
+	getCmd.AddCommand(ecs.ListCapacityProviders())
+	createCmd.AddCommand(ecs.CreateCapacityProvider())
+	setCmd.AddCommand(ecs.SetCapacityStrategy())
 
 	//service
 	getCmd.AddCommand(ecs.ListServices())
 	describeCmd.AddCommand(ecs.DescribeService())
 	logsCmd.AddCommand(ecs.ServiceLogs())
+	getCmd.AddCommand(ecs.ListEnv())
+	getCmd.AddCommand(ecs.ListTargets())
 	deleteCmd.AddCommand(ecs.DeleteService())
+	createCmd.AddCommand(ecs.CreateService())
 
 	//nodes
 	getCmd.AddCommand(ecs.ListNodes())
+	describeCmd.AddCommand(ecs.DescribeNode())
+	capacityCmd.AddCommand(ecs.CapacityCheck())
+	nodesCmd.AddCommand(ecs.OutdatedNodes())
+	nodesCmd.AddCommand(ecs.RotateNodes())
+	drainCmd.AddCommand(ecs.DrainNode())
+	undrainCmd.AddCommand(ecs.UndrainNode())
+	deleteCmd.AddCommand(ecs.DeleteNode())
 
 	//taskdefinition
 	getCmd.AddCommand(ecs.ListTaskDefinition())
@@ -72,6 +131,7 @@ func main() {
 	//revision
 	getCmd.AddCommand(ecs.ListTaskDefinitionRevision())
 	setCmd.AddCommand(ecs.UpdateRevision())
+	setCmd.AddCommand(ecs.SetResources())
 
 	//task
 	getCmd.AddCommand(ecs.ListTasks())
@@ -82,12 +142,27 @@ func main() {
 	//exec
 	rootCmd.AddCommand(ecs.Exec())
 
+	//run
+	rootCmd.AddCommand(ecs.Run())
+
+	//cronjobs
+	createCmd.AddCommand(ecs.CreateCronJob())
+	deleteCmd.AddCommand(ecs.DeleteCronJob())
+	cronjobCmd.AddCommand(ecs.TriggerCronJob())
+
 	//replicas
 	setCmd.AddCommand(ecs.Replicas())
 
 	//autoscaling
 	getCmd.AddCommand(ecs.ListAutoscaling())
 	setCmd.AddCommand(ecs.Autoscaling())
+	getCmd.AddCommand(ecs.ListScalingActivity())
+	getCmd.AddCommand(ecs.ListSchedules())
+	setCmd.AddCommand(ecs.Schedule())
+	deleteCmd.AddCommand(ecs.DeleteAutoscaling())
+	autoscaleCmd.AddCommand(ecs.SuspendAutoscaling())
+	autoscaleCmd.AddCommand(ecs.ResumeAutoscaling())
+	autoscaleCmd.AddCommand(ecs.Simulate())
 
 	//root
 	rootCmd.AddCommand(getCmd)
@@ -95,7 +170,15 @@ func main() {
 	rootCmd.AddCommand(logsCmd)
 	rootCmd.AddCommand(setCmd)
 	rootCmd.AddCommand(deleteCmd)
+	rootCmd.AddCommand(createCmd)
+	rootCmd.AddCommand(cronjobCmd)
+	rootCmd.AddCommand(drainCmd)
+	rootCmd.AddCommand(undrainCmd)
+	rootCmd.AddCommand(capacityCmd)
+	rootCmd.AddCommand(nodesCmd)
+	rootCmd.AddCommand(autoscaleCmd)
 	rootCmd.AddCommand(ecs.Deploy())
+	rootCmd.AddCommand(ecs.Top())
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println("Error:", err)
@@ -0,0 +1,61 @@
+package cw
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+)
+
+// AddAlarmAction appends actionArn to the ALARM actions of an existing metric alarm
+func AddAlarmAction(ctx context.Context, cfg aws.Config, alarmName string, actionArn string) error {
+	client := cloudwatch.NewFromConfig(cfg)
+
+	out, err := client.DescribeAlarms(ctx, &cloudwatch.DescribeAlarmsInput{
+		AlarmNames: []string{alarmName},
+	})
+	if err != nil {
+		return fmt.Errorf("describe alarm %q: %w", alarmName, err)
+	}
+	if len(out.MetricAlarms) == 0 {
+		return fmt.Errorf("alarm %q not found", alarmName)
+	}
+
+	alarm := out.MetricAlarms[0]
+	for _, action := range alarm.AlarmActions {
+		if action == actionArn {
+			return nil
+		}
+	}
+
+	// PutMetricAlarm replaces the whole alarm, so every field has to be sent back
+	_, err = client.PutMetricAlarm(ctx, &cloudwatch.PutMetricAlarmInput{
+		AlarmName:                        alarm.AlarmName,
+		AlarmDescription:                 alarm.AlarmDescription,
+		ActionsEnabled:                   alarm.ActionsEnabled,
+		AlarmActions:                     append(alarm.AlarmActions, actionArn),
+		OKActions:                        alarm.OKActions,
+		InsufficientDataActions:          alarm.InsufficientDataActions,
+		ComparisonOperator:               alarm.ComparisonOperator,
+		EvaluationPeriods:                alarm.EvaluationPeriods,
+		DatapointsToAlarm:                alarm.DatapointsToAlarm,
+		Threshold:                        alarm.Threshold,
+		ThresholdMetricId:                alarm.ThresholdMetricId,
+		TreatMissingData:                 alarm.TreatMissingData,
+		EvaluateLowSampleCountPercentile: alarm.EvaluateLowSampleCountPercentile,
+		Namespace:                        alarm.Namespace,
+		MetricName:                       alarm.MetricName,
+		Dimensions:                       alarm.Dimensions,
+		Statistic:                        alarm.Statistic,
+		ExtendedStatistic:                alarm.ExtendedStatistic,
+		Period:                           alarm.Period,
+		Unit:                             alarm.Unit,
+		Metrics:                          alarm.Metrics,
+	})
+	if err != nil {
+		return fmt.Errorf("update alarm %q: %w", alarmName, err)
+	}
+
+	return nil
+}
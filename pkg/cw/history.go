@@ -0,0 +1,139 @@
+package cw
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+// Sample is one period of a service's load
+type Sample struct {
+	Time     time.Time `json:"time"`
+	CPU      float64   `json:"cpu"`      // average CPUUtilization (%)
+	Memory   float64   `json:"memory"`   // average MemoryUtilization (%)
+	Requests float64   `json:"requests"` // RequestCountPerTarget over the period
+	Tasks    float64   `json:"tasks"`    // running tasks during the period
+}
+
+// ServiceHistory is a service's load over a time window, as recorded by `nami autoscale simulate --record`
+type ServiceHistory struct {
+	Cluster        string   `json:"cluster"`
+	Service        string   `json:"service"`
+	Period         int32    `json:"period"`
+	TasksEstimated bool     `json:"tasksEstimated"` // task counts derived from sample counts, Container Insights was not available
+	Samples        []Sample `json:"samples"`
+}
+
+// GetServiceHistory reads CPU, memory, ALB requests per target and running task count of a service.
+// targetGroup is the TargetGroup dimension value (targetgroup/name/id) or empty when the service has no load balancer.
+func GetServiceHistory(ctx context.Context, cfg aws.Config, cluster, service, targetGroup string, start, end time.Time, period int32) (*ServiceHistory, error) {
+	serviceDims := []types.Dimension{
+		{Name: aws.String("ClusterName"), Value: aws.String(cluster)},
+		{Name: aws.String("ServiceName"), Value: aws.String(service)},
+	}
+
+	queries := []types.MetricDataQuery{
+		metricQuery("cpu", "AWS/ECS", "CPUUtilization", serviceDims, period, "Average"),
+		metricQuery("mem", "AWS/ECS", "MemoryUtilization", serviceDims, period, "Average"),
+		metricQuery("cpucount", "AWS/ECS", "CPUUtilization", serviceDims, period, "SampleCount"),
+		metricQuery("tasks", "ECS/ContainerInsights", "RunningTaskCount", serviceDims, period, "Average"),
+	}
+	if targetGroup != "" {
+		queries = append(queries, metricQuery("req", "AWS/ApplicationELB", "RequestCountPerTarget",
+			[]types.Dimension{{Name: aws.String("TargetGroup"), Value: aws.String(targetGroup)}}, period, "Sum"))
+	}
+
+	series, err := getMetricData(ctx, cloudwatch.NewFromConfig(cfg), queries, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	history := &ServiceHistory{Cluster: cluster, Service: service, Period: period}
+	samples := make(map[time.Time]*Sample)
+	sample := func(t time.Time) *Sample {
+		if s, ok := samples[t]; ok {
+			return s
+		}
+		s := &Sample{Time: t}
+		samples[t] = s
+		return s
+	}
+
+	for t, v := range series["cpu"] {
+		sample(t).CPU = v
+	}
+	for t, v := range series["mem"] {
+		sample(t).Memory = v
+	}
+	for t, v := range series["req"] {
+		sample(t).Requests = v
+	}
+	if len(series["tasks"]) > 0 {
+		for t, v := range series["tasks"] {
+			sample(t).Tasks = v
+		}
+	} else {
+		// Service CPUUtilization is reported by each task once a minute
+		history.TasksEstimated = true
+		for t, v := range series["cpucount"] {
+			sample(t).Tasks = v / (float64(period) / 60)
+		}
+	}
+
+	for _, s := range samples {
+		history.Samples = append(history.Samples, *s)
+	}
+	sort.Slice(history.Samples, func(i, j int) bool { return history.Samples[i].Time.Before(history.Samples[j].Time) })
+
+	return history, nil
+}
+
+func metricQuery(id, namespace, name string, dimensions []types.Dimension, period int32, stat string) types.MetricDataQuery {
+	return types.MetricDataQuery{
+		Id: aws.String(id),
+		MetricStat: &types.MetricStat{
+			Metric: &types.Metric{
+				Namespace:  aws.String(namespace),
+				MetricName: aws.String(name),
+				Dimensions: dimensions,
+			},
+			Period: aws.Int32(period),
+			Stat:   aws.String(stat),
+		},
+	}
+}
+
+// getMetricData runs the queries and returns the values of each query ID by timestamp
+func getMetricData(ctx context.Context, client *cloudwatch.Client, queries []types.MetricDataQuery, start, end time.Time) (map[string]map[time.Time]float64, error) {
+	series := make(map[string]map[time.Time]float64)
+
+	paginator := cloudwatch.NewGetMetricDataPaginator(client, &cloudwatch.GetMetricDataInput{
+		MetricDataQueries: queries,
+		StartTime:         aws.Time(start),
+		EndTime:           aws.Time(end),
+		ScanBy:            types.ScanByTimestampAscending,
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("get metric data: %w", err)
+		}
+
+		for _, result := range page.MetricDataResults {
+			id := aws.ToString(result.Id)
+			if series[id] == nil {
+				series[id] = make(map[time.Time]float64)
+			}
+			for i, t := range result.Timestamps {
+				series[id][t] = result.Values[i]
+			}
+		}
+	}
+
+	return series, nil
+}
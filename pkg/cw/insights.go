@@ -0,0 +1,173 @@
+package cw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	logtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+)
+
+// TaskLoad is a task's recent CPU and memory from the Container Insights performance log events, one value
+// per period, oldest first. Periods without data are NaN.
+type TaskLoad struct {
+	TaskID         string
+	CPU            []float64 // % of the reserved CPU
+	Memory         []float64 // % of the reserved memory
+	CPUUtilized    float64   // CPU units in the latest period
+	CPUReserved    float64
+	MemoryUtilized float64 // MiB in the latest period
+	MemoryReserved float64
+}
+
+// PerformanceLogGroup is where Container Insights writes the cluster's performance log events
+func PerformanceLogGroup(cluster string) string {
+	return fmt.Sprintf("/aws/ecs/containerinsights/%s/performance", cluster)
+}
+
+// GetTaskLoad reads the CPU and memory of every task of the cluster over the window
+func GetTaskLoad(ctx context.Context, cfg aws.Config, cluster string, window time.Duration, period int32) (map[string]*TaskLoad, error) {
+	query := fmt.Sprintf(`filter Type = "Task"
+| stats avg(CpuUtilized) as cpu, avg(CpuReserved) as cpuReserved, avg(MemoryUtilized) as memory, avg(MemoryReserved) as memoryReserved by TaskId, bin(%ds) as period
+| limit 10000`, period)
+
+	step := time.Duration(period) * time.Second
+	end := time.Now().Truncate(step)
+	start := end.Add(-window)
+	buckets := int(window / step)
+
+	rows, err := runInsightsQuery(ctx, cloudwatchlogs.NewFromConfig(cfg), PerformanceLogGroup(cluster), query, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	tasks := make(map[string]*TaskLoad)
+	latest := make(map[string]int)
+	for _, row := range rows {
+		id := row["TaskId"]
+		t, err := time.Parse("2006-01-02 15:04:05.000", row["period"])
+		if id == "" || err != nil {
+			continue
+		}
+
+		task, ok := tasks[id]
+		if !ok {
+			task = &TaskLoad{TaskID: id, CPU: nanSeries(buckets), Memory: nanSeries(buckets)}
+			tasks[id] = task
+			latest[id] = -1
+		}
+
+		i := int(t.Sub(start) / step)
+		if i < 0 || i >= buckets {
+			continue
+		}
+
+		cpu, cpuReserved := parseFloat(row["cpu"]), parseFloat(row["cpuReserved"])
+		memory, memoryReserved := parseFloat(row["memory"]), parseFloat(row["memoryReserved"])
+		task.CPU[i] = percent(cpu, cpuReserved)
+		task.Memory[i] = percent(memory, memoryReserved)
+
+		if i > latest[id] {
+			latest[id] = i
+			task.CPUUtilized, task.CPUReserved = cpu, cpuReserved
+			task.MemoryUtilized, task.MemoryReserved = memory, memoryReserved
+		}
+	}
+
+	return tasks, nil
+}
+
+// LatestMessages returns the @message of the latest event matching filter for each value of the field by,
+// among the events of the log group since start
+func LatestMessages(ctx context.Context, cfg aws.Config, logGroup, filter, by string, start time.Time) (map[string]string, error) {
+	query := fmt.Sprintf(`filter %s
+| stats latest(@message) as message by %s as key
+| limit 10000`, filter, by)
+
+	rows, err := runInsightsQuery(ctx, cloudwatchlogs.NewFromConfig(cfg), logGroup, query, start, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make(map[string]string, len(rows))
+	for _, row := range rows {
+		if row["key"] != "" {
+			messages[row["key"]] = row["message"]
+		}
+	}
+
+	return messages, nil
+}
+
+// runInsightsQuery runs a Logs Insights query and returns its rows as field name to value
+func runInsightsQuery(ctx context.Context, client *cloudwatchlogs.Client, logGroup, query string, start, end time.Time) ([]map[string]string, error) {
+	out, err := client.StartQuery(ctx, &cloudwatchlogs.StartQueryInput{
+		LogGroupName: aws.String(logGroup),
+		QueryString:  aws.String(query),
+		StartTime:    aws.Int64(start.Unix()),
+		EndTime:      aws.Int64(end.Unix()),
+	})
+	if err != nil {
+		var notFound *logtypes.ResourceNotFoundException
+		if errors.As(err, &notFound) {
+			if strings.HasPrefix(logGroup, "/aws/ecs/containerinsights/") {
+				return nil, fmt.Errorf("log group %s not found, is Container Insights enabled on the cluster?", logGroup)
+			}
+			return nil, fmt.Errorf("log group %s not found", logGroup)
+		}
+		return nil, fmt.Errorf("start query: %w", err)
+	}
+
+	for {
+		results, err := client.GetQueryResults(ctx, &cloudwatchlogs.GetQueryResultsInput{QueryId: out.QueryId})
+		if err != nil {
+			return nil, fmt.Errorf("get query results: %w", err)
+		}
+
+		switch results.Status {
+		case logtypes.QueryStatusComplete:
+			rows := make([]map[string]string, len(results.Results))
+			for i, fields := range results.Results {
+				rows[i] = make(map[string]string, len(fields))
+				for _, field := range fields {
+					rows[i][aws.ToString(field.Field)] = aws.ToString(field.Value)
+				}
+			}
+			return rows, nil
+		case logtypes.QueryStatusFailed, logtypes.QueryStatusCancelled, logtypes.QueryStatusTimeout:
+			return nil, fmt.Errorf("query on %s %s", logGroup, results.Status)
+		}
+
+		time.Sleep(time.Second)
+	}
+}
+
+func nanSeries(n int) []float64 {
+	out := make([]float64, n)
+	for i := range out {
+		out[i] = math.NaN()
+	}
+	return out
+}
+
+func parseFloat(s string) float64 {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return math.NaN()
+	}
+	return v
+}
+
+// percent returns used as a percentage of reserved, NaN when nothing is reserved
+func percent(used, reserved float64) float64 {
+	if reserved <= 0 || math.IsNaN(used) {
+		return math.NaN()
+	}
+	return used / reserved * 100
+}
@@ -0,0 +1,141 @@
+package cw
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+// LoadBalancerTarget holds the CloudWatch dimension values of a target group behind a load balancer
+type LoadBalancerTarget struct {
+	LoadBalancer string // app/name/id
+	TargetGroup  string // targetgroup/name/id
+}
+
+// ServiceLoad is a service's recent load with one value per period, oldest first. Periods without data are NaN.
+type ServiceLoad struct {
+	CPU      []float64 // average CPUUtilization (%)
+	Memory   []float64 // average MemoryUtilization (%)
+	Requests []float64 // ALB requests over the period, summed over the service's target groups
+	Errors   []float64 // target 5XX responses over the period
+}
+
+// GetServiceLoad reads CPU, memory, ALB requests and target 5XX responses of the services over the window,
+// batching the queries of many services into each GetMetricData call
+func GetServiceLoad(ctx context.Context, cfg aws.Config, services []ServiceKey, targets map[ServiceKey][]LoadBalancerTarget, window time.Duration, period int32) (map[ServiceKey]ServiceLoad, error) {
+	var queries []types.MetricDataQuery
+	for i, svc := range services {
+		dims := []types.Dimension{
+			{Name: aws.String("ClusterName"), Value: aws.String(svc.Cluster)},
+			{Name: aws.String("ServiceName"), Value: aws.String(svc.Service)},
+		}
+		queries = append(queries,
+			metricQuery(fmt.Sprintf("cpu_%d", i), "AWS/ECS", "CPUUtilization", dims, period, "Average"),
+			metricQuery(fmt.Sprintf("mem_%d", i), "AWS/ECS", "MemoryUtilization", dims, period, "Average"),
+		)
+
+		for j, target := range targets[svc] {
+			dims := []types.Dimension{
+				{Name: aws.String("LoadBalancer"), Value: aws.String(target.LoadBalancer)},
+				{Name: aws.String("TargetGroup"), Value: aws.String(target.TargetGroup)},
+			}
+			queries = append(queries,
+				metricQuery(fmt.Sprintf("req_%d_%d", i, j), "AWS/ApplicationELB", "RequestCount", dims, period, "Sum"),
+				metricQuery(fmt.Sprintf("err_%d_%d", i, j), "AWS/ApplicationELB", "HTTPCode_Target_5XX_Count", dims, period, "Sum"),
+			)
+		}
+	}
+
+	step := time.Duration(period) * time.Second
+	end := time.Now().Truncate(step)
+	start := end.Add(-window)
+	buckets := int(window / step)
+
+	series, err := batchMetricData(ctx, cloudwatch.NewFromConfig(cfg), queries, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	values := func(id string) []float64 {
+		out := nanSeries(buckets)
+		for t, v := range series[id] {
+			if i := int(t.Sub(start) / step); i >= 0 && i < buckets {
+				out[i] = v
+			}
+		}
+		return out
+	}
+
+	output := make(map[ServiceKey]ServiceLoad, len(services))
+	for i, svc := range services {
+		load := ServiceLoad{
+			CPU:    values(fmt.Sprintf("cpu_%d", i)),
+			Memory: values(fmt.Sprintf("mem_%d", i)),
+		}
+
+		for j := range targets[svc] {
+			load.Requests = addSeries(load.Requests, values(fmt.Sprintf("req_%d_%d", i, j)))
+			load.Errors = addSeries(load.Errors, values(fmt.Sprintf("err_%d_%d", i, j)))
+		}
+
+		output[svc] = load
+	}
+
+	return output, nil
+}
+
+// addSeries sums two series; a period is NaN only when both are
+func addSeries(a, b []float64) []float64 {
+	if a == nil {
+		return b
+	}
+	for i := range a {
+		switch {
+		case math.IsNaN(a[i]):
+			a[i] = b[i]
+		case !math.IsNaN(b[i]):
+			a[i] += b[i]
+		}
+	}
+	return a
+}
+
+// Latest returns the most recent value of a series that is not NaN
+func Latest(values []float64) (float64, bool) {
+	if i := LatestIndex(values); i >= 0 {
+		return values[i], true
+	}
+	return 0, false
+}
+
+// LatestIndex returns the index of the most recent value of a series that is not NaN, or -1
+func LatestIndex(values []float64) int {
+	for i := len(values) - 1; i >= 0; i-- {
+		if !math.IsNaN(values[i]) {
+			return i
+		}
+	}
+	return -1
+}
+
+// batchMetricData runs the queries in batches of at most 500 and merges the series
+func batchMetricData(ctx context.Context, client *cloudwatch.Client, queries []types.MetricDataQuery, start, end time.Time) (map[string]map[time.Time]float64, error) {
+	series := make(map[string]map[time.Time]float64)
+
+	for i := 0; i < len(queries); i += maxQueries {
+		batch, err := getMetricData(ctx, client, queries[i:min(i+maxQueries, len(queries))], start, end)
+		if err != nil {
+			return nil, err
+		}
+		for id, points := range batch {
+			series[id] = points
+		}
+	}
+
+	return series, nil
+}
@@ -1,96 +1,151 @@
 package cw
 
 import (
+	"context"
 	"fmt"
+	"regexp"
+	"strings"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
 )
 
-func CpuAverage(cluster string, service string) float64 {
-	var utilization float64
-	sess := session.Must(session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-	}))
-	svc := cloudwatch.New(sess)
-
-	input := &cloudwatch.GetMetricStatisticsInput{
-		Namespace:  aws.String("AWS/ECS"),
-		MetricName: aws.String("CPUUtilization"),
-		Dimensions: []*cloudwatch.Dimension{
-			{
-				Name:  aws.String("ClusterName"),
-				Value: aws.String(cluster),
-			},
-			{
-				Name:  aws.String("ServiceName"),
-				Value: aws.String(service),
-			},
-		},
-		StartTime: aws.Time(time.Now().Add(-1 * 24 * time.Hour)),
-		EndTime:   aws.Time(time.Now()),
-		Period:    aws.Int64(300),
-		Statistics: []*string{
-			aws.String(cloudwatch.StatisticAverage),
-		},
+// GetMetricData accepts at most 500 queries per call
+const maxQueries = 500
+
+// ServiceKey identifies a service in the AWS/ECS metrics
+type ServiceKey struct {
+	Cluster string
+	Service string
+}
+
+// Utilization is a service's CPU and memory utilization (%). HasData is false when CloudWatch has no
+// datapoint in the window.
+type Utilization struct {
+	CPU     float64
+	Memory  float64
+	HasData bool
+}
+
+// MetricsOptions selects which value of a metric is reported. With no Window the latest one-minute
+// datapoint is used, otherwise Stat is computed over the whole window.
+type MetricsOptions struct {
+	Window time.Duration
+	Stat   string // Average, Minimum, Maximum or a percentile such as p95
+}
+
+var percentile = regexp.MustCompile(`^p\d{1,2}(\.\d+)?$`)
+
+// ParseStat normalizes a statistic name such as avg, max or p95
+func ParseStat(stat string) (string, error) {
+	switch s := strings.ToLower(stat); {
+	case s == "avg" || s == "average":
+		return "Average", nil
+	case s == "max" || s == "maximum":
+		return "Maximum", nil
+	case s == "min" || s == "minimum":
+		return "Minimum", nil
+	case percentile.MatchString(s):
+		return s, nil
 	}
+	return "", fmt.Errorf("invalid statistic %q: expected avg, min, max or a percentile such as p95", stat)
+}
 
-	result, err := svc.GetMetricStatistics(input)
-	if err != nil {
-		utilization = 0.0
-		fmt.Println(err)
+// Label describes the reported value, e.g. "latest" or "p95 15m"
+func (o MetricsOptions) Label() string {
+	stat := strings.ToLower(o.Stat)
+	switch o.Stat {
+	case "", "Average":
+		stat = "average"
+	case "Maximum":
+		stat = "max"
+	case "Minimum":
+		stat = "min"
 	}
 
-	if len(result.Datapoints) > 0 {
-		utilization = aws.Float64Value(result.Datapoints[0].Average)
-	} else {
-		utilization = 0.0
+	if o.Window == 0 {
+		if stat == "average" {
+			return "latest"
+		}
+		return "latest " + stat
 	}
 
-	return utilization
+	window := o.Window.String()
+	if strings.HasSuffix(window, "m0s") {
+		window = strings.TrimSuffix(window, "0s")
+	}
+	if strings.HasSuffix(window, "h0m") {
+		window = strings.TrimSuffix(window, "0m")
+	}
+	return stat + " " + window
 }
 
-func MemoryAverage(cluster string, service string) float64 {
-	var utilization float64
-	sess := session.Must(session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-	}))
-	svc := cloudwatch.New(sess)
-
-	input := &cloudwatch.GetMetricStatisticsInput{
-		Namespace:  aws.String("AWS/ECS"),
-		MetricName: aws.String("MemoryUtilization"),
-		Dimensions: []*cloudwatch.Dimension{
-			{
-				Name:  aws.String("ClusterName"),
-				Value: aws.String(cluster),
-			},
-			{
-				Name:  aws.String("ServiceName"),
-				Value: aws.String(service),
-			},
-		},
-		StartTime: aws.Time(time.Now().Add(-1 * 24 * time.Hour)),
-		EndTime:   aws.Time(time.Now()),
-		Period:    aws.Int64(300),
-		Statistics: []*string{
-			aws.String(cloudwatch.StatisticAverage),
-		},
+// period returns the query period and window: one period spanning the window, or one-minute periods
+// over the last 10 minutes to find the latest datapoint
+func (o MetricsOptions) period() (int32, time.Duration) {
+	if o.Window == 0 {
+		return 60, 10 * time.Minute
 	}
 
-	result, err := svc.GetMetricStatistics(input)
+	seconds := int32((o.Window + time.Minute - 1) / time.Minute * 60)
+	return seconds, time.Duration(seconds) * time.Second
+}
+
+// GetServiceUtilization reads the CPUUtilization and MemoryUtilization of the services, batching the queries
+// of many services into each GetMetricData call
+func GetServiceUtilization(ctx context.Context, cfg aws.Config, services []ServiceKey, opts MetricsOptions) (map[ServiceKey]Utilization, error) {
+	if opts.Stat == "" {
+		opts.Stat = "Average"
+	}
+	period, window := opts.period()
+
+	var queries []types.MetricDataQuery
+	for i, svc := range services {
+		dims := []types.Dimension{
+			{Name: aws.String("ClusterName"), Value: aws.String(svc.Cluster)},
+			{Name: aws.String("ServiceName"), Value: aws.String(svc.Service)},
+		}
+		queries = append(queries,
+			metricQuery(fmt.Sprintf("cpu_%d", i), "AWS/ECS", "CPUUtilization", dims, period, opts.Stat),
+			metricQuery(fmt.Sprintf("mem_%d", i), "AWS/ECS", "MemoryUtilization", dims, period, opts.Stat),
+		)
+	}
+
+	end := time.Now().Truncate(time.Minute)
+	values, err := latestValues(ctx, cloudwatch.NewFromConfig(cfg), queries, end.Add(-window), end)
+	if err != nil {
+		return nil, err
+	}
+
+	output := make(map[ServiceKey]Utilization, len(services))
+	for i, svc := range services {
+		cpu, hasCPU := values[fmt.Sprintf("cpu_%d", i)]
+		memory, hasMemory := values[fmt.Sprintf("mem_%d", i)]
+		output[svc] = Utilization{CPU: cpu, Memory: memory, HasData: hasCPU || hasMemory}
+	}
+
+	return output, nil
+}
+
+// latestValues runs the queries in batches and returns the most recent value of each query ID that has data
+func latestValues(ctx context.Context, client *cloudwatch.Client, queries []types.MetricDataQuery, start, end time.Time) (map[string]float64, error) {
+	series, err := batchMetricData(ctx, client, queries, start, end)
 	if err != nil {
-		utilization = 0.0
-		fmt.Println(err)
+		return nil, err
 	}
 
-	if len(result.Datapoints) > 0 {
-		utilization = aws.Float64Value(result.Datapoints[0].Average)
-	} else {
-		utilization = 0.0
+	values := make(map[string]float64)
+	for id, points := range series {
+		var latest time.Time
+		for t, v := range points {
+			if t.After(latest) {
+				latest = t
+				values[id] = v
+			}
+		}
 	}
 
-	return utilization
+	return values, nil
 }
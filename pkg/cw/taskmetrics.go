@@ -0,0 +1,122 @@
+package cw
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+)
+
+// ResourceMetrics is the resource usage of a task or container over a window. Fields are NaN when the
+// performance log events do not report them (e.g. ephemeral storage outside Fargate).
+type ResourceMetrics struct {
+	CPUUtilized       float64 // average CPU units
+	CPUReserved       float64
+	MemoryUtilized    float64 // average MiB
+	MemoryMax         float64 // peak MiB
+	MemoryFirst       float64 // MiB at the start and end of the window, to spot leaks
+	MemoryLast        float64
+	MemoryReserved    float64
+	NetworkRx         float64 // average bytes per second
+	NetworkTx         float64
+	StorageRead       float64 // bytes over the window
+	StorageWrite      float64
+	EphemeralUtilized float64 // GiB, Fargate only
+	EphemeralReserved float64
+}
+
+// TaskMetrics is a task's resource usage with the usage of each of its containers
+type TaskMetrics struct {
+	TaskID string
+	ResourceMetrics
+	Containers map[string]ResourceMetrics // by container name, only with Container Insights enhanced observability
+}
+
+// CPUPercent returns the CPU used as a percentage of the reserved CPU
+func (m ResourceMetrics) CPUPercent() float64 {
+	return percent(m.CPUUtilized, m.CPUReserved)
+}
+
+// MemoryPercent returns the memory used as a percentage of the reserved memory
+func (m ResourceMetrics) MemoryPercent() float64 {
+	return percent(m.MemoryUtilized, m.MemoryReserved)
+}
+
+// GetTaskMetrics reads task and container usage over the window from the Container Insights performance log
+// events of the cluster. With no task IDs every task of the cluster is returned.
+func GetTaskMetrics(ctx context.Context, cfg aws.Config, cluster string, taskIDs []string, window time.Duration) (map[string]*TaskMetrics, error) {
+	filter := `filter Type = "Task" or Type = "Container"`
+	if len(taskIDs) > 0 {
+		quoted := make([]string, len(taskIDs))
+		for i, id := range taskIDs {
+			quoted[i] = fmt.Sprintf("%q", id)
+		}
+		filter += fmt.Sprintf(" | filter TaskId in [%s]", strings.Join(quoted, ", "))
+	}
+
+	query := filter + `
+| stats avg(CpuUtilized) as cpu, avg(CpuReserved) as cpuReserved,
+    avg(MemoryUtilized) as memory, max(MemoryUtilized) as memoryMax, earliest(MemoryUtilized) as memoryFirst,
+    latest(MemoryUtilized) as memoryLast, avg(MemoryReserved) as memoryReserved,
+    avg(NetworkRxBytes) as rx, avg(NetworkTxBytes) as tx, sum(StorageReadBytes) as read, sum(StorageWriteBytes) as write,
+    avg(EphemeralStorageUtilized) as ephemeral, avg(EphemeralStorageReserved) as ephemeralReserved
+  by Type, TaskId, ContainerName
+| limit 10000`
+
+	end := time.Now()
+	rows, err := runInsightsQuery(ctx, cloudwatchlogs.NewFromConfig(cfg), PerformanceLogGroup(cluster), query, end.Add(-window), end)
+	if err != nil {
+		return nil, err
+	}
+
+	tasks := make(map[string]*TaskMetrics)
+	task := func(id string) *TaskMetrics {
+		if t, ok := tasks[id]; ok {
+			return t
+		}
+		t := &TaskMetrics{TaskID: id, ResourceMetrics: EmptyMetrics(), Containers: make(map[string]ResourceMetrics)}
+		tasks[id] = t
+		return t
+	}
+
+	for _, row := range rows {
+		id := row["TaskId"]
+		if id == "" {
+			continue
+		}
+
+		m := ResourceMetrics{
+			CPUUtilized:       parseFloat(row["cpu"]),
+			CPUReserved:       parseFloat(row["cpuReserved"]),
+			MemoryUtilized:    parseFloat(row["memory"]),
+			MemoryMax:         parseFloat(row["memoryMax"]),
+			MemoryFirst:       parseFloat(row["memoryFirst"]),
+			MemoryLast:        parseFloat(row["memoryLast"]),
+			MemoryReserved:    parseFloat(row["memoryReserved"]),
+			NetworkRx:         parseFloat(row["rx"]),
+			NetworkTx:         parseFloat(row["tx"]),
+			StorageRead:       parseFloat(row["read"]),
+			StorageWrite:      parseFloat(row["write"]),
+			EphemeralUtilized: parseFloat(row["ephemeral"]),
+			EphemeralReserved: parseFloat(row["ephemeralReserved"]),
+		}
+
+		if row["Type"] == "Container" {
+			task(id).Containers[row["ContainerName"]] = m
+		} else {
+			task(id).ResourceMetrics = m
+		}
+	}
+
+	return tasks, nil
+}
+
+// EmptyMetrics returns metrics with every field unknown (NaN)
+func EmptyMetrics() ResourceMetrics {
+	nan := math.NaN()
+	return ResourceMetrics{nan, nan, nan, nan, nan, nan, nan, nan, nan, nan, nan, nan, nan}
+}
@@ -3,187 +3,300 @@ package ecs
 import (
 	"context"
 	"fmt"
-	"log"
 	"os"
+	"strconv"
+	"strings"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/applicationautoscaling"
 	"github.com/aws/aws-sdk-go-v2/service/applicationautoscaling/types"
+	awsecs "github.com/aws/aws-sdk-go-v2/service/ecs"
 	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
-	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/chnacib/nami/pkg/cw"
 	"github.com/spf13/cobra"
 )
 
+type AutoscaleOptions struct {
+	Cluster          string
+	Service          string
+	Min              int32
+	Max              int32
+	Cpu              int32
+	Mem              int32
+	Request          int32
+	ScaleInCooldown  int32
+	ScaleOutCooldown int32
+	DisableScaleIn   bool
+
+	// Target tracking on a custom CloudWatch metric
+	MetricNamespace  string
+	MetricName       string
+	MetricDimensions map[string]string
+	MetricStatistic  string
+	MetricTarget     float64
+
+	// Step scaling policy triggered by existing CloudWatch alarms
+	StepPolicy         string
+	StepAdjustments    []string // lower:upper:adjustment, bounds relative to the alarm threshold
+	StepAdjustmentType string
+	StepCooldown       int32
+	StepAlarms         []string
+}
+
 func Autoscaling() *cobra.Command {
-	var cluster string
-	var minimum int
-	var maximum int
-	var cpu int32
-	var mem int32
-	var request int32
+	var opts AutoscaleOptions
 
 	cmd := &cobra.Command{
 		Use:     "autoscale",
 		Aliases: []string{"as", "autoscaling", "scale"},
 		Short:   "Register autoscaling config",
-		Run: func(cmd *cobra.Command, args []string) {
-			service := args[0]
-			registerScalableTarget(cluster, service, int32(minimum), int32(maximum), cpu, mem, request)
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.Service = args[0]
+			if err := registerScalableTarget(cmd.Context(), opts); err != nil {
+				return err
+			}
+
+			fmt.Println("autoscaling configured")
+			return nil
 		},
+		SilenceUsage: true,
 	}
 
-	cmd.Flags().Int32VarP(&request, "request", "", 0, "Memory Average utilization")
-	cmd.Flags().Int32VarP(&mem, "mem", "", 0, "Memory Average utilization")
-	cmd.Flags().Int32VarP(&cpu, "cpu", "", 0, "CPU Average utilization")
-	cmd.Flags().IntVarP(&maximum, "max", "", 1, "Maximum desired count")
+	cmd.Flags().Int32VarP(&opts.Request, "request", "", 0, "ALB request count per target")
+	cmd.Flags().Int32VarP(&opts.Mem, "mem", "", 0, "Memory Average utilization")
+	cmd.Flags().Int32VarP(&opts.Cpu, "cpu", "", 0, "CPU Average utilization")
+	cmd.Flags().Int32VarP(&opts.Max, "max", "", 1, "Maximum desired count")
 	cmd.MarkFlagRequired("max")
-	cmd.Flags().IntVarP(&minimum, "min", "", 1, "Minimum desired count")
+	cmd.Flags().Int32VarP(&opts.Min, "min", "", 1, "Minimum desired count")
 	cmd.MarkFlagRequired("min")
-	cmd.Flags().StringVarP(&cluster, "cluster", "c", "string", "ECS Cluster name")
+	cmd.Flags().Int32Var(&opts.ScaleInCooldown, "scale-in-cooldown", 300, "Seconds to wait after a scale-in before another scale-in")
+	cmd.Flags().Int32Var(&opts.ScaleOutCooldown, "scale-out-cooldown", 60, "Seconds to wait after a scale-out before another scale-out")
+	cmd.Flags().BoolVar(&opts.DisableScaleIn, "disable-scale-in", false, "Target tracking policies only scale out")
+	cmd.Flags().StringVar(&opts.MetricNamespace, "metric-namespace", "", "Custom metric namespace for target tracking")
+	cmd.Flags().StringVar(&opts.MetricName, "metric-name", "", "Custom metric name for target tracking")
+	cmd.Flags().StringToStringVar(&opts.MetricDimensions, "metric-dimension", nil, "Custom metric dimensions (Name=Value)")
+	cmd.Flags().StringVar(&opts.MetricStatistic, "metric-statistic", "Average", "Custom metric statistic (Average, Minimum, Maximum, SampleCount, Sum)")
+	cmd.Flags().Float64Var(&opts.MetricTarget, "metric-target", 0, "Custom metric target value")
+	cmd.Flags().StringVar(&opts.StepPolicy, "step-policy", "", "Name of a step scaling policy to create or update")
+	cmd.Flags().StringArrayVar(&opts.StepAdjustments, "step", nil, "Step adjustment lower:upper:adjustment, bounds relative to the alarm threshold (e.g. 0:20:1, 20::3)")
+	cmd.Flags().StringVar(&opts.StepAdjustmentType, "step-adjustment-type", "ChangeInCapacity", "ChangeInCapacity, PercentChangeInCapacity or ExactCapacity")
+	cmd.Flags().Int32Var(&opts.StepCooldown, "step-cooldown", 300, "Step scaling policy cooldown in seconds")
+	cmd.Flags().StringArrayVar(&opts.StepAlarms, "step-alarm", nil, "CloudWatch alarm that triggers the step policy")
+	cmd.Flags().StringVarP(&opts.Cluster, "cluster", "c", "", "ECS Cluster name")
 	cmd.MarkFlagRequired("cluster")
 	return cmd
 }
 
-func registerScalableTarget(clusterName, serviceName string, minCapacity, maxCapacity, cpu, mem, request int32) error {
-	cfg, err := config.LoadDefaultConfig(context.TODO())
+func registerScalableTarget(ctx context.Context, opts AutoscaleOptions) error {
+	if opts.MetricName != "" && (opts.MetricNamespace == "" || opts.MetricTarget == 0) {
+		return fmt.Errorf("--metric-name requires --metric-namespace and --metric-target")
+	}
+	if opts.StepPolicy != "" && len(opts.StepAdjustments) == 0 {
+		return fmt.Errorf("--step-policy requires at least one --step")
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to load AWS configuration: %v", err)
 	}
-	sess := session.Must(session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-	}))
-
-	client_elb := elasticloadbalancingv2.NewFromConfig(cfg)
-
-	client_ecs := ecs.New(sess)
 
 	client := applicationautoscaling.NewFromConfig(cfg)
 
-	resourceID := fmt.Sprintf("service/%s/%s", clusterName, serviceName)
+	resourceID := fmt.Sprintf("service/%s/%s", opts.Cluster, opts.Service)
 
 	input := &applicationautoscaling.RegisterScalableTargetInput{
 		ServiceNamespace:  types.ServiceNamespaceEcs,
 		ResourceId:        &resourceID,
 		ScalableDimension: types.ScalableDimensionECSServiceDesiredCount,
-		MinCapacity:       &minCapacity,
-		MaxCapacity:       &maxCapacity,
+		MinCapacity:       &opts.Min,
+		MaxCapacity:       &opts.Max,
 		SuspendedState:    nil,
 	}
 
-	_, err = client.RegisterScalableTarget(context.TODO(), input)
+	_, err = client.RegisterScalableTarget(ctx, input)
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(0)
+		return fmt.Errorf("register scalable target: %w", err)
 	}
 
-	cpuScalingInput := &applicationautoscaling.PutScalingPolicyInput{
-		PolicyName:        aws.String("CPUTrackingPolicy"),
-		PolicyType:        types.PolicyTypeTargetTrackingScaling,
-		ResourceId:        &resourceID,
-		ScalableDimension: types.ScalableDimensionECSServiceDesiredCount,
-		ServiceNamespace:  types.ServiceNamespaceEcs,
-		TargetTrackingScalingPolicyConfiguration: &types.TargetTrackingScalingPolicyConfiguration{
-			ScaleInCooldown:  aws.Int32(0),
-			ScaleOutCooldown: aws.Int32(0),
-			TargetValue:      aws.Float64(float64(cpu)),
-			PredefinedMetricSpecification: &types.PredefinedMetricSpecification{
-				PredefinedMetricType: types.MetricType("ECSServiceAverageCPUUtilization"),
-			},
-		},
-	}
-
-	memScalingInput := &applicationautoscaling.PutScalingPolicyInput{
-		PolicyName:        aws.String("MemoryTrackingPolicy"),
-		PolicyType:        types.PolicyTypeTargetTrackingScaling,
-		ResourceId:        &resourceID,
-		ScalableDimension: types.ScalableDimensionECSServiceDesiredCount,
-		ServiceNamespace:  types.ServiceNamespaceEcs,
-		TargetTrackingScalingPolicyConfiguration: &types.TargetTrackingScalingPolicyConfiguration{
-			ScaleInCooldown:  aws.Int32(0),
-			ScaleOutCooldown: aws.Int32(0),
-			TargetValue:      aws.Float64(float64(mem)),
-			PredefinedMetricSpecification: &types.PredefinedMetricSpecification{
-				PredefinedMetricType: types.MetricType("ECSServiceAverageMemoryUtilization"),
+	trackingPolicy := func(name string, target float64, predefined *types.PredefinedMetricSpecification, custom *types.CustomizedMetricSpecification) *applicationautoscaling.PutScalingPolicyInput {
+		return &applicationautoscaling.PutScalingPolicyInput{
+			PolicyName:        aws.String(name),
+			PolicyType:        types.PolicyTypeTargetTrackingScaling,
+			ResourceId:        &resourceID,
+			ScalableDimension: types.ScalableDimensionECSServiceDesiredCount,
+			ServiceNamespace:  types.ServiceNamespaceEcs,
+			TargetTrackingScalingPolicyConfiguration: &types.TargetTrackingScalingPolicyConfiguration{
+				ScaleInCooldown:               aws.Int32(opts.ScaleInCooldown),
+				ScaleOutCooldown:              aws.Int32(opts.ScaleOutCooldown),
+				DisableScaleIn:                aws.Bool(opts.DisableScaleIn),
+				TargetValue:                   aws.Float64(target),
+				PredefinedMetricSpecification: predefined,
+				CustomizedMetricSpecification: custom,
 			},
-		},
+		}
 	}
 
-	if cpu != 0 {
-		_, err = client.PutScalingPolicy(context.TODO(), cpuScalingInput)
+	if opts.Cpu != 0 {
+		_, err = client.PutScalingPolicy(ctx, trackingPolicy(cpuPolicyName, float64(opts.Cpu), &types.PredefinedMetricSpecification{
+			PredefinedMetricType: types.MetricTypeECSServiceAverageCPUUtilization,
+		}, nil))
 		if err != nil {
-			fmt.Println(err)
-			os.Exit(0)
+			return fmt.Errorf("put CPU scaling policy: %w", err)
 		}
 	}
 
-	if mem != 0 {
-		_, err = client.PutScalingPolicy(context.TODO(), memScalingInput)
+	if opts.Mem != 0 {
+		_, err = client.PutScalingPolicy(ctx, trackingPolicy(memPolicyName, float64(opts.Mem), &types.PredefinedMetricSpecification{
+			PredefinedMetricType: types.MetricTypeECSServiceAverageMemoryUtilization,
+		}, nil))
 		if err != nil {
-			fmt.Println(err)
-			os.Exit(0)
+			return fmt.Errorf("put memory scaling policy: %w", err)
 		}
 	}
 
-	if request != 0 {
-		input := &ecs.DescribeServicesInput{
-			Services: []*string{
-				aws.String(serviceName),
-			},
-			Cluster: aws.String(clusterName),
+	if opts.Request != 0 {
+		resourceLabel, err := requestResourceLabel(ctx, cfg, opts.Cluster, opts.Service)
+		if err != nil {
+			return err
 		}
 
-		response, err := client_ecs.DescribeServices(input)
+		_, err = client.PutScalingPolicy(ctx, trackingPolicy(requestPolicyName, float64(opts.Request), &types.PredefinedMetricSpecification{
+			PredefinedMetricType: types.MetricTypeALBRequestCountPerTarget,
+			ResourceLabel:        aws.String(resourceLabel),
+		}, nil))
 		if err != nil {
-			fmt.Println(err)
-			os.Exit(0)
+			return fmt.Errorf("put request scaling policy: %w", err)
 		}
+	}
 
-		target_group := aws.StringValue(response.Services[0].LoadBalancers[0].TargetGroupArn)
-
-		inputTG := &elasticloadbalancingv2.DescribeTargetGroupsInput{
-			TargetGroupArns: []string{
-				*aws.String(target_group),
-			},
+	if opts.MetricName != "" {
+		var dimensions []types.MetricDimension
+		for name, value := range opts.MetricDimensions {
+			dimensions = append(dimensions, types.MetricDimension{Name: aws.String(name), Value: aws.String(value)})
 		}
 
-		outputTG, err := client_elb.DescribeTargetGroups(context.TODO(), inputTG)
+		_, err = client.PutScalingPolicy(ctx, trackingPolicy(customPolicyName, opts.MetricTarget, nil, &types.CustomizedMetricSpecification{
+			Namespace:  aws.String(opts.MetricNamespace),
+			MetricName: aws.String(opts.MetricName),
+			Dimensions: dimensions,
+			Statistic:  types.MetricStatistic(opts.MetricStatistic),
+		}))
 		if err != nil {
-			log.Fatalf("Error describing target groups: %v", err)
+			return fmt.Errorf("put custom metric scaling policy: %w", err)
 		}
+	}
 
-		loadbalancer := outputTG.TargetGroups[0].LoadBalancerArns[0]
-		resource_label := extractLoadBalancerID(loadbalancer) + "/" + extractTargetGroupID(target_group)
+	if opts.StepPolicy != "" {
+		adjustments, err := parseStepAdjustments(opts.StepAdjustments)
+		if err != nil {
+			return err
+		}
 
-		requestScalingInput := &applicationautoscaling.PutScalingPolicyInput{
-			PolicyName:        aws.String("RequestTrackingPolicy"),
-			PolicyType:        types.PolicyTypeTargetTrackingScaling,
+		out, err := client.PutScalingPolicy(ctx, &applicationautoscaling.PutScalingPolicyInput{
+			PolicyName:        aws.String(opts.StepPolicy),
+			PolicyType:        types.PolicyTypeStepScaling,
 			ResourceId:        &resourceID,
 			ScalableDimension: types.ScalableDimensionECSServiceDesiredCount,
 			ServiceNamespace:  types.ServiceNamespaceEcs,
-			TargetTrackingScalingPolicyConfiguration: &types.TargetTrackingScalingPolicyConfiguration{
-				ScaleInCooldown:  aws.Int32(0),
-				ScaleOutCooldown: aws.Int32(0),
-				TargetValue:      aws.Float64(float64(request)),
-				PredefinedMetricSpecification: &types.PredefinedMetricSpecification{
-					PredefinedMetricType: types.MetricType("ALBRequestCountPerTarget"),
-					ResourceLabel:        aws.String(resource_label),
-				},
+			StepScalingPolicyConfiguration: &types.StepScalingPolicyConfiguration{
+				AdjustmentType:        types.AdjustmentType(opts.StepAdjustmentType),
+				Cooldown:              aws.Int32(opts.StepCooldown),
+				MetricAggregationType: types.MetricAggregationTypeAverage,
+				StepAdjustments:       adjustments,
 			},
-		}
-		_, err = client.PutScalingPolicy(context.TODO(), requestScalingInput)
+		})
 		if err != nil {
-			fmt.Println(err)
-			os.Exit(0)
+			return fmt.Errorf("put step scaling policy: %w", err)
 		}
-	}
 
-	fmt.Printf("autoscaling configured")
+		for _, alarm := range opts.StepAlarms {
+			if err := cw.AddAlarmAction(ctx, cfg, alarm, aws.ToString(out.PolicyARN)); err != nil {
+				return err
+			}
+		}
+	}
 
 	return nil
 }
 
+// Policy names used by `nami set autoscale`
+const (
+	cpuPolicyName     = "CPUTrackingPolicy"
+	memPolicyName     = "MemoryTrackingPolicy"
+	requestPolicyName = "RequestTrackingPolicy"
+	customPolicyName  = "CustomMetricTrackingPolicy"
+)
+
+// requestResourceLabel builds the ALBRequestCountPerTarget resource label for the service's first target group
+func requestResourceLabel(ctx context.Context, cfg aws.Config, cluster, service string) (string, error) {
+	svcOut, err := awsecs.NewFromConfig(cfg).DescribeServices(ctx, &awsecs.DescribeServicesInput{
+		Cluster:  aws.String(cluster),
+		Services: []string{service},
+	})
+	if err != nil {
+		return "", fmt.Errorf("describe service: %w", err)
+	}
+	if len(svcOut.Services) == 0 || len(svcOut.Services[0].LoadBalancers) == 0 {
+		return "", fmt.Errorf("service %q has no load balancer target group", service)
+	}
+
+	targetGroup := aws.ToString(svcOut.Services[0].LoadBalancers[0].TargetGroupArn)
+
+	outputTG, err := elasticloadbalancingv2.NewFromConfig(cfg).DescribeTargetGroups(ctx, &elasticloadbalancingv2.DescribeTargetGroupsInput{
+		TargetGroupArns: []string{targetGroup},
+	})
+	if err != nil {
+		return "", fmt.Errorf("describe target group: %w", err)
+	}
+	if len(outputTG.TargetGroups) == 0 || len(outputTG.TargetGroups[0].LoadBalancerArns) == 0 {
+		return "", fmt.Errorf("target group %q is not attached to a load balancer", targetGroup)
+	}
+
+	loadbalancer := outputTG.TargetGroups[0].LoadBalancerArns[0]
+	return extractLoadBalancerID(loadbalancer) + "/" + extractTargetGroupID(targetGroup), nil
+}
+
+// parseStepAdjustments parses lower:upper:adjustment triples; an empty bound is unbounded
+func parseStepAdjustments(steps []string) ([]types.StepAdjustment, error) {
+	var adjustments []types.StepAdjustment
+
+	for _, step := range steps {
+		parts := strings.Split(step, ":")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("invalid step %q: expected lower:upper:adjustment", step)
+		}
+
+		adjustment, err := strconv.Atoi(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid step %q: adjustment must be an integer", step)
+		}
+
+		sa := types.StepAdjustment{ScalingAdjustment: aws.Int32(int32(adjustment))}
+		if parts[0] != "" {
+			lower, err := strconv.ParseFloat(parts[0], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid step %q: lower bound must be a number", step)
+			}
+			sa.MetricIntervalLowerBound = aws.Float64(lower)
+		}
+		if parts[1] != "" {
+			upper, err := strconv.ParseFloat(parts[1], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid step %q: upper bound must be a number", step)
+			}
+			sa.MetricIntervalUpperBound = aws.Float64(upper)
+		}
+
+		adjustments = append(adjustments, sa)
+	}
+
+	return adjustments, nil
+}
+
 func UpdateDesiredCount(service string, cluster string, desired int64) {
 	sess := session.Must(session.NewSessionWithOptions(session.Options{
 		SharedConfigState: session.SharedConfigEnable,
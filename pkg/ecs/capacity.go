@@ -0,0 +1,439 @@
+package ecs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsecs "github.com/aws/aws-sdk-go-v2/service/ecs"
+	ectypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/chnacib/nami/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+// PlacementRequest is what each copy of a task needs from a node
+type PlacementRequest struct {
+	TaskDefinition   string
+	Service          string
+	CPU              int32
+	Memory           int32
+	GPU              int
+	HostPorts        []string
+	Attributes       []ectypes.Attribute
+	DistinctInstance bool
+	MemberOf         []string
+}
+
+type PlacementResult struct {
+	Requested int
+	Placed    map[string]int // node ID -> tasks placed
+	Blocked   map[string]int // reason -> nodes that rejected the first task that did not fit
+	Nodes     int
+	Skipped   []string // constraints nami cannot simulate
+}
+
+// CapacityCheck returns the `nami capacity check` command
+func CapacityCheck() *cobra.Command {
+	var (
+		cluster string
+		count   int
+	)
+
+	cmd := &cobra.Command{
+		Use:   "check [service|taskdefinition]",
+		Short: "Simulate placing tasks on the cluster's container instances",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			req, defaultCount, err := placementRequest(cmd.Context(), cluster, args[0])
+			if err != nil {
+				return err
+			}
+			if count <= 0 {
+				count = defaultCount
+			}
+
+			nodes, err := GetNodes(cmd.Context(), cluster)
+			if err != nil {
+				return err
+			}
+			if len(nodes) == 0 {
+				return printNoNodes(cmd.Context(), cluster)
+			}
+
+			existing := map[string]int{}
+			if req.DistinctInstance && req.Service != "" {
+				if existing, err = serviceTasksPerNode(cmd.Context(), cluster, req.Service); err != nil {
+					return err
+				}
+			}
+
+			result := simulatePlacement(req, nodes, existing, count)
+			printPlacement(req, result)
+
+			if placed := result.placed(); placed < count {
+				return fmt.Errorf("only %d of %d tasks can be placed", placed, count)
+			}
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVarP(&cluster, "cluster", "c", "", "ECS Cluster name")
+	cmd.MarkFlagRequired("cluster")
+	cmd.Flags().IntVar(&count, "count", 0, "Tasks to place (default the service desired count, or 1 for a task definition)")
+
+	return cmd
+}
+
+func (r PlacementResult) placed() int {
+	total := 0
+	for _, n := range r.Placed {
+		total += n
+	}
+	return total
+}
+
+// placementRequest reads the requirements of a service (its task definition plus its placement constraints)
+// or of a task definition, and the default number of copies to place
+func placementRequest(ctx context.Context, cluster, target string) (PlacementRequest, int, error) {
+	var req PlacementRequest
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return req, 0, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	client := awsecs.NewFromConfig(cfg.AwsConfig)
+	count := 1
+
+	var constraints []ectypes.PlacementConstraint
+	var td *ectypes.TaskDefinition
+
+	svc, err := describeService(ctx, client, cluster, target)
+	if err == nil && aws.ToString(svc.Status) == "ACTIVE" {
+		req.Service = aws.ToString(svc.ServiceName)
+		count = int(svc.DesiredCount)
+		constraints = svc.PlacementConstraints
+
+		out, err := client.DescribeTaskDefinition(ctx, &awsecs.DescribeTaskDefinitionInput{TaskDefinition: svc.TaskDefinition})
+		if err != nil {
+			return req, 0, fmt.Errorf("describe task definition: %w", err)
+		}
+		td = out.TaskDefinition
+	} else {
+		out, err := client.DescribeTaskDefinition(ctx, &awsecs.DescribeTaskDefinitionInput{TaskDefinition: aws.String(target)})
+		if err != nil {
+			return req, 0, fmt.Errorf("%q is neither a service in %s nor a task definition: %w", target, cluster, err)
+		}
+		td = out.TaskDefinition
+	}
+
+	if !runsOnEC2(td) {
+		return req, 0, fmt.Errorf("task definition %s only runs on Fargate, there is no placement to simulate", NameArn(aws.ToString(td.TaskDefinitionArn)))
+	}
+
+	req.TaskDefinition = NameArn(aws.ToString(td.TaskDefinitionArn))
+	req.CPU, req.Memory = taskDefinitionReservation(td)
+	req.Attributes = td.RequiresAttributes
+
+	for _, c := range td.ContainerDefinitions {
+		for _, r := range c.ResourceRequirements {
+			if r.Type == ectypes.ResourceTypeGpu {
+				gpu, _ := strconv.Atoi(aws.ToString(r.Value))
+				req.GPU += gpu
+			}
+		}
+
+		if td.NetworkMode == ectypes.NetworkModeAwsvpc {
+			continue
+		}
+		for _, pm := range c.PortMappings {
+			port := aws.ToInt32(pm.HostPort)
+			if td.NetworkMode == ectypes.NetworkModeHost {
+				port = aws.ToInt32(pm.ContainerPort)
+			}
+			if port > 0 {
+				req.HostPorts = append(req.HostPorts, strconv.Itoa(int(port)))
+			}
+		}
+	}
+
+	for _, c := range td.PlacementConstraints {
+		constraints = append(constraints, ectypes.PlacementConstraint{Type: ectypes.PlacementConstraintType(c.Type), Expression: c.Expression})
+	}
+	for _, c := range constraints {
+		switch c.Type {
+		case ectypes.PlacementConstraintTypeDistinctInstance:
+			req.DistinctInstance = true
+		case ectypes.PlacementConstraintTypeMemberOf:
+			req.MemberOf = append(req.MemberOf, aws.ToString(c.Expression))
+		}
+	}
+
+	return req, count, nil
+}
+
+// serviceTasksPerNode counts the running tasks of the service on each node
+func serviceTasksPerNode(ctx context.Context, cluster, service string) (map[string]int, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	client := awsecs.NewFromConfig(cfg.AwsConfig)
+	tasks, err := serviceTasks(ctx, client, cluster, service, ectypes.DesiredStatusRunning)
+	if err != nil {
+		return nil, err
+	}
+
+	perNode := make(map[string]int)
+	for _, task := range tasks {
+		if task.ContainerInstanceArn != nil {
+			perNode[NameArn(aws.ToString(task.ContainerInstanceArn))]++
+		}
+	}
+	return perNode, nil
+}
+
+type nodeCapacity struct {
+	node     NodeOutput
+	cpu      int32
+	memory   int32
+	gpu      int
+	ports    map[string]bool
+	attrs    map[string]string
+	existing int
+	placed   int
+}
+
+// simulatePlacement places count new tasks one by one on the node with the most free memory that accepts them
+func simulatePlacement(req PlacementRequest, nodes []NodeOutput, existing map[string]int, count int) PlacementResult {
+	result := PlacementResult{
+		Requested: count,
+		Placed:    make(map[string]int),
+		Blocked:   make(map[string]int),
+		Nodes:     len(nodes),
+	}
+
+	capacity := make([]*nodeCapacity, len(nodes))
+	for i, n := range nodes {
+		c := &nodeCapacity{
+			node:     n,
+			cpu:      n.RemainingCPU,
+			memory:   n.RemainingMemory,
+			gpu:      n.RemainingGPU,
+			ports:    make(map[string]bool),
+			attrs:    make(map[string]string),
+			existing: existing[n.ID],
+		}
+		for _, p := range n.UsedPorts {
+			c.ports[p] = true
+		}
+		for _, a := range n.Instance.Attributes {
+			c.attrs[aws.ToString(a.Name)] = aws.ToString(a.Value)
+		}
+		capacity[i] = c
+	}
+
+	for _, expr := range req.MemberOf {
+		if _, err := evalMemberOf(expr, nil); err != nil {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("memberOf(%s): %v", expr, err))
+		}
+	}
+
+	for i := 0; i < count; i++ {
+		sort.SliceStable(capacity, func(i, j int) bool { return capacity[i].memory > capacity[j].memory })
+
+		var chosen *nodeCapacity
+		reasons := make(map[string]int)
+		for _, c := range capacity {
+			if reason := c.rejects(req); reason != "" {
+				reasons[reason]++
+				continue
+			}
+			chosen = c
+			break
+		}
+
+		if chosen == nil {
+			result.Blocked = reasons
+			break
+		}
+
+		chosen.cpu -= req.CPU
+		chosen.memory -= req.Memory
+		chosen.gpu -= req.GPU
+		for _, p := range req.HostPorts {
+			chosen.ports[p] = true
+		}
+		chosen.placed++
+		result.Placed[chosen.node.ID]++
+	}
+
+	return result
+}
+
+// rejects returns why the node cannot take one more copy, or "" when it can
+func (c *nodeCapacity) rejects(req PlacementRequest) string {
+	switch {
+	case c.node.Status != "ACTIVE":
+		return "node is " + c.node.Status
+	case !c.node.AgentConnected:
+		return "agent disconnected"
+	case req.DistinctInstance && c.existing+c.placed > 0:
+		return "distinctInstance: node already runs the service"
+	case c.cpu < req.CPU:
+		return "insufficient CPU"
+	case c.memory < req.Memory:
+		return "insufficient memory"
+	case c.gpu < req.GPU:
+		return "insufficient GPU"
+	}
+
+	for _, p := range req.HostPorts {
+		if c.ports[p] {
+			return fmt.Sprintf("host port %s in use", p)
+		}
+	}
+
+	for _, a := range req.Attributes {
+		value, ok := c.attrs[aws.ToString(a.Name)]
+		if !ok || (a.Value != nil && value != aws.ToString(a.Value)) {
+			return "missing attribute " + aws.ToString(a.Name)
+		}
+	}
+
+	for _, expr := range req.MemberOf {
+		ok, err := evalMemberOf(expr, c.attrs)
+		if err == nil && !ok {
+			return "memberOf(" + expr + ")"
+		}
+	}
+
+	return ""
+}
+
+var memberOfClause = regexp.MustCompile(`^attribute:(\S+)\s+(==|!=|=~|!~|in|not_in|exists|not_exists)\s*(.*)$`)
+
+// evalMemberOf evaluates a cluster query language expression on node attributes. Only attribute clauses
+// joined by "and" or "or" (without parentheses) are supported.
+func evalMemberOf(expr string, attrs map[string]string) (bool, error) {
+	if strings.ContainsAny(expr, "()") {
+		return false, errors.New("parentheses are not supported")
+	}
+
+	for _, alternative := range strings.Split(expr, " or ") {
+		all := true
+		for _, clause := range strings.Split(alternative, " and ") {
+			ok, err := evalClause(strings.TrimSpace(clause), attrs)
+			if err != nil {
+				return false, err
+			}
+			if !ok {
+				all = false
+			}
+		}
+		if all {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func evalClause(clause string, attrs map[string]string) (bool, error) {
+	m := memberOfClause.FindStringSubmatch(clause)
+	if m == nil {
+		return false, fmt.Errorf("unsupported clause %q", clause)
+	}
+
+	value, exists := attrs[m[1]]
+	operand := strings.TrimSpace(m[3])
+
+	switch m[2] {
+	case "exists":
+		return exists, nil
+	case "not_exists":
+		return !exists, nil
+	case "==":
+		return exists && value == operand, nil
+	case "!=":
+		return !exists || value != operand, nil
+	case "=~", "!~":
+		pattern, err := regexp.Compile("^" + strings.ReplaceAll(regexp.QuoteMeta(operand), `\*`, ".*") + "$")
+		if err != nil {
+			return false, err
+		}
+		return exists && pattern.MatchString(value) == (m[2] == "=~"), nil
+	}
+
+	// in / not_in [a, b]
+	found := false
+	for _, item := range strings.Split(strings.Trim(operand, "[]"), ",") {
+		if exists && strings.TrimSpace(item) == value {
+			found = true
+		}
+	}
+	return found == (m[2] == "in"), nil
+}
+
+func printPlacement(req PlacementRequest, result PlacementResult) {
+	needs := fmt.Sprintf("%d CPU, %d MiB", req.CPU, req.Memory)
+	if req.GPU > 0 {
+		needs += fmt.Sprintf(", %d GPU", req.GPU)
+	}
+	if len(req.HostPorts) > 0 {
+		needs += ", host ports " + strings.Join(req.HostPorts, ",")
+	}
+	if req.DistinctInstance {
+		needs += ", distinctInstance"
+	}
+	for _, expr := range req.MemberOf {
+		needs += ", memberOf(" + expr + ")"
+	}
+	fmt.Printf("%s needs %s per task\n", req.TaskDefinition, needs)
+
+	placed := result.placed()
+	fmt.Printf("%d of %d tasks fit on %d nodes\n\n", placed, result.Requested, result.Nodes)
+
+	if placed > 0 {
+		var ids []string
+		for id := range result.Placed {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "NODE\tTASKS")
+		for _, id := range ids {
+			fmt.Fprintf(w, "%s\t+%d\n", id, result.Placed[id])
+		}
+		w.Flush()
+		fmt.Println()
+	}
+
+	if placed < result.Requested {
+		fmt.Printf("%d tasks cannot be placed:\n", result.Requested-placed)
+
+		var reasons []string
+		for reason := range result.Blocked {
+			reasons = append(reasons, reason)
+		}
+		sort.Slice(reasons, func(i, j int) bool { return result.Blocked[reasons[i]] > result.Blocked[reasons[j]] })
+		for _, reason := range reasons {
+			fmt.Printf("  %s on %d nodes\n", reason, result.Blocked[reason])
+		}
+		fmt.Println()
+	}
+
+	for _, skipped := range result.Skipped {
+		fmt.Printf("Not simulated: %s\n", skipped)
+	}
+}
@@ -0,0 +1,430 @@
+package ecs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsecs "github.com/aws/aws-sdk-go-v2/service/ecs"
+	ectypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/chnacib/nami/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+type CreateCapacityProviderOptions struct {
+	Name                  string // default derived from the Auto Scaling group name
+	AsgArn                string
+	ManagedScaling        *ectypes.ManagedScaling
+	TerminationProtection bool
+	ManagedDraining       bool
+	Cluster               string // associate the new provider with this cluster
+}
+
+// ListCapacityProviders returns the `nami get capacityproviders` command
+func ListCapacityProviders() *cobra.Command {
+	var cluster string
+
+	cmd := &cobra.Command{
+		Use:     "capacityproviders",
+		Aliases: []string{"capacityprovider", "cp"},
+		Short:   "List capacity providers, or the ones associated with a cluster",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			providers, strategy, err := GetCapacityProviders(cmd.Context(), cluster)
+			if err != nil {
+				return err
+			}
+
+			weights := make(map[string]string)
+			for _, item := range strategy {
+				weights[aws.ToString(item.CapacityProvider)] = fmt.Sprintf("%d", item.Weight)
+				if item.Base > 0 {
+					weights[aws.ToString(item.CapacityProvider)] += fmt.Sprintf(" (base %d)", item.Base)
+				}
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+			header := "NAME\tSTATUS\tAUTO SCALING GROUP\tMANAGED SCALING\tTERMINATION PROTECTION\tMANAGED DRAINING"
+			if cluster != "" {
+				header += "\tDEFAULT WEIGHT"
+			}
+			fmt.Fprintln(w, header)
+
+			for _, cp := range providers {
+				group, scaling, protection, draining := "-", "-", "-", "-"
+				if asg := cp.AutoScalingGroupProvider; asg != nil {
+					group = asgName(aws.ToString(asg.AutoScalingGroupArn))
+					scaling = formatManagedScaling(asg.ManagedScaling)
+					protection = string(asg.ManagedTerminationProtection)
+					draining = valueOrDash(string(asg.ManagedDraining))
+				}
+
+				row := fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%s", aws.ToString(cp.Name), cp.Status, group, scaling, protection, draining)
+				if cluster != "" {
+					row += "\t" + valueOrDash(weights[aws.ToString(cp.Name)])
+				}
+				fmt.Fprintln(w, row)
+			}
+
+			w.Flush()
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVarP(&cluster, "cluster", "c", "", "Only the capacity providers of this ECS cluster, with its default strategy")
+
+	return cmd
+}
+
+// CreateCapacityProvider returns the `nami create capacityprovider` command
+func CreateCapacityProvider() *cobra.Command {
+	var (
+		opts    CreateCapacityProviderOptions
+		scaling string
+	)
+
+	cmd := &cobra.Command{
+		Use:     "capacityprovider [name]",
+		Aliases: []string{"capacityproviders", "cp"},
+		Short:   "Create a capacity provider for an Auto Scaling group",
+		Args:    cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 0 {
+				opts.Name = args[0]
+			}
+
+			managed, err := parseManagedScaling(scaling)
+			if err != nil {
+				return err
+			}
+			opts.ManagedScaling = managed
+
+			cfg, err := config.LoadConfig()
+			if err != nil {
+				return fmt.Errorf("failed to load configuration: %w", err)
+			}
+
+			client := awsecs.NewFromConfig(cfg.AwsConfig)
+
+			cp, err := createCapacityProvider(cmd.Context(), client, opts)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Capacity provider %s created for Auto Scaling group %s\n", aws.ToString(cp.Name), asgName(opts.AsgArn))
+
+			if opts.Cluster == "" {
+				return nil
+			}
+
+			if err := addClusterCapacityProvider(cmd.Context(), client, opts.Cluster, aws.ToString(cp.Name)); err != nil {
+				return err
+			}
+			fmt.Printf("Capacity provider %s associated with cluster %s\n", aws.ToString(cp.Name), opts.Cluster)
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVar(&opts.AsgArn, "asg", "", "Auto Scaling group ARN")
+	cmd.MarkFlagRequired("asg")
+	cmd.Flags().StringVar(&scaling, "managed-scaling", "target=100", "Managed scaling settings target=N[,min-step=N][,max-step=N][,warmup=SECONDS], or disabled")
+	cmd.Flags().BoolVar(&opts.TerminationProtection, "termination-protection", false, "Enable managed termination protection (the group needs scale-in protection)")
+	cmd.Flags().BoolVar(&opts.ManagedDraining, "managed-draining", true, "Drain instances before the Auto Scaling group terminates them")
+	cmd.Flags().StringVarP(&opts.Cluster, "cluster", "c", "", "Associate the capacity provider with this ECS cluster")
+
+	return cmd
+}
+
+// SetCapacityStrategy returns the `nami set capacity-strategy` command
+func SetCapacityStrategy() *cobra.Command {
+	var (
+		cluster string
+		base    int32
+	)
+
+	cmd := &cobra.Command{
+		Use:     "capacity-strategy [service] [provider:weight,...]",
+		Aliases: []string{"capacitystrategy", "strategy"},
+		Short:   "Set the capacity provider strategy of a service and redeploy it",
+		Args:    cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			strategy, err := parseCapacityProviderStrategy(strings.Split(args[1], ","), base)
+			if err != nil {
+				return err
+			}
+
+			cfg, err := config.LoadConfig()
+			if err != nil {
+				return fmt.Errorf("failed to load configuration: %w", err)
+			}
+
+			client := awsecs.NewFromConfig(cfg.AwsConfig)
+
+			svc, err := describeService(ctx, client, cluster, args[0])
+			if err != nil {
+				return err
+			}
+
+			current := formatStrategy(svc.CapacityProviderStrategy)
+			if len(svc.CapacityProviderStrategy) == 0 && svc.LaunchType != "" {
+				current = "launch type " + string(svc.LaunchType)
+			}
+
+			_, err = client.UpdateService(ctx, &awsecs.UpdateServiceInput{
+				Cluster:                  aws.String(cluster),
+				Service:                  aws.String(args[0]),
+				CapacityProviderStrategy: strategy,
+				ForceNewDeployment:       true,
+			})
+			if err != nil {
+				return fmt.Errorf("update service: %w", err)
+			}
+
+			fmt.Printf("Service %s capacity provider strategy updated, new deployment started\n", args[0])
+			fmt.Printf("  from: %s\n  to:   %s\n\n", current, formatStrategy(strategy))
+			printStrategySplit(strategy, svc.DesiredCount)
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVarP(&cluster, "cluster", "c", "", "ECS Cluster name")
+	cmd.MarkFlagRequired("cluster")
+	cmd.Flags().Int32Var(&base, "base", 0, "Tasks to run on the first provider before weights apply")
+
+	return cmd
+}
+
+// GetCapacityProviders returns every capacity provider of the account, or only the ones associated with the
+// cluster together with its default strategy
+func GetCapacityProviders(ctx context.Context, cluster string) ([]ectypes.CapacityProvider, []ectypes.CapacityProviderStrategyItem, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	client := awsecs.NewFromConfig(cfg.AwsConfig)
+
+	input := &awsecs.DescribeCapacityProvidersInput{}
+	var strategy []ectypes.CapacityProviderStrategyItem
+
+	if cluster != "" {
+		out, err := client.DescribeClusters(ctx, &awsecs.DescribeClustersInput{Clusters: []string{cluster}})
+		if err != nil {
+			return nil, nil, fmt.Errorf("describe cluster: %w", err)
+		}
+		if len(out.Clusters) == 0 || aws.ToString(out.Clusters[0].Status) == "INACTIVE" {
+			return nil, nil, fmt.Errorf("cluster %q not found", cluster)
+		}
+		if len(out.Clusters[0].CapacityProviders) == 0 {
+			return nil, nil, nil
+		}
+		input.CapacityProviders = out.Clusters[0].CapacityProviders
+		strategy = out.Clusters[0].DefaultCapacityProviderStrategy
+	}
+
+	var providers []ectypes.CapacityProvider
+	for {
+		out, err := client.DescribeCapacityProviders(ctx, input)
+		if err != nil {
+			return nil, nil, fmt.Errorf("describe capacity providers: %w", err)
+		}
+		providers = append(providers, out.CapacityProviders...)
+
+		if out.NextToken == nil {
+			break
+		}
+		input.NextToken = out.NextToken
+	}
+
+	sort.Slice(providers, func(i, j int) bool { return aws.ToString(providers[i].Name) < aws.ToString(providers[j].Name) })
+	return providers, strategy, nil
+}
+
+func createCapacityProvider(ctx context.Context, client *awsecs.Client, opts CreateCapacityProviderOptions) (*ectypes.CapacityProvider, error) {
+	if !strings.Contains(opts.AsgArn, ":autoScalingGroupName/") {
+		return nil, fmt.Errorf("invalid Auto Scaling group ARN %q", opts.AsgArn)
+	}
+
+	name := opts.Name
+	if name == "" {
+		// Capacity provider names cannot start with aws, ecs or fargate
+		name = asgName(opts.AsgArn)
+		for _, reserved := range []string{"aws", "ecs", "fargate"} {
+			if strings.HasPrefix(strings.ToLower(name), reserved) {
+				name = "cp-" + name
+				break
+			}
+		}
+	}
+
+	provider := &ectypes.AutoScalingGroupProvider{
+		AutoScalingGroupArn:          aws.String(opts.AsgArn),
+		ManagedScaling:               opts.ManagedScaling,
+		ManagedTerminationProtection: ectypes.ManagedTerminationProtectionDisabled,
+		ManagedDraining:              ectypes.ManagedDrainingEnabled,
+	}
+	if opts.TerminationProtection {
+		provider.ManagedTerminationProtection = ectypes.ManagedTerminationProtectionEnabled
+	}
+	if !opts.ManagedDraining {
+		provider.ManagedDraining = ectypes.ManagedDrainingDisabled
+	}
+
+	out, err := client.CreateCapacityProvider(ctx, &awsecs.CreateCapacityProviderInput{
+		Name:                     aws.String(name),
+		AutoScalingGroupProvider: provider,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create capacity provider for %s: %w", asgName(opts.AsgArn), err)
+	}
+
+	return out.CapacityProvider, nil
+}
+
+// addClusterCapacityProvider associates the provider with the cluster, keeping its providers and default strategy
+func addClusterCapacityProvider(ctx context.Context, client *awsecs.Client, cluster, provider string) error {
+	out, err := client.DescribeClusters(ctx, &awsecs.DescribeClustersInput{Clusters: []string{cluster}})
+	if err != nil {
+		return fmt.Errorf("describe cluster: %w", err)
+	}
+	if len(out.Clusters) == 0 || aws.ToString(out.Clusters[0].Status) == "INACTIVE" {
+		return fmt.Errorf("cluster %q not found", cluster)
+	}
+
+	c := out.Clusters[0]
+	strategy := c.DefaultCapacityProviderStrategy
+	if strategy == nil {
+		strategy = []ectypes.CapacityProviderStrategyItem{}
+	}
+
+	_, err = client.PutClusterCapacityProviders(ctx, &awsecs.PutClusterCapacityProvidersInput{
+		Cluster:                         aws.String(cluster),
+		CapacityProviders:               append(c.CapacityProviders, provider),
+		DefaultCapacityProviderStrategy: strategy,
+	})
+	if err != nil {
+		return fmt.Errorf("put cluster capacity providers: %w", err)
+	}
+
+	return nil
+}
+
+// parseManagedScaling parses target=N[,min-step=N][,max-step=N][,warmup=SECONDS] or disabled
+func parseManagedScaling(spec string) (*ectypes.ManagedScaling, error) {
+	if spec == "disabled" || spec == "off" {
+		return &ectypes.ManagedScaling{Status: ectypes.ManagedScalingStatusDisabled}, nil
+	}
+
+	scaling := &ectypes.ManagedScaling{Status: ectypes.ManagedScalingStatusEnabled}
+	for _, kv := range strings.Split(spec, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(kv), "=")
+		n, err := strconv.Atoi(value)
+		if !ok || err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid --managed-scaling %q: expected key=number", kv)
+		}
+
+		switch key {
+		case "target":
+			if n < 1 || n > 100 {
+				return nil, fmt.Errorf("invalid --managed-scaling target %d: expected 1-100", n)
+			}
+			scaling.TargetCapacity = aws.Int32(int32(n))
+		case "min-step":
+			scaling.MinimumScalingStepSize = aws.Int32(int32(n))
+		case "max-step":
+			scaling.MaximumScalingStepSize = aws.Int32(int32(n))
+		case "warmup":
+			scaling.InstanceWarmupPeriod = aws.Int32(int32(n))
+		default:
+			return nil, fmt.Errorf("invalid --managed-scaling key %q: expected target, min-step, max-step or warmup", key)
+		}
+	}
+
+	return scaling, nil
+}
+
+func formatManagedScaling(scaling *ectypes.ManagedScaling) string {
+	if scaling == nil || scaling.Status != ectypes.ManagedScalingStatusEnabled {
+		return "DISABLED"
+	}
+
+	s := fmt.Sprintf("target %d%%", aws.ToInt32(scaling.TargetCapacity))
+	if scaling.MinimumScalingStepSize != nil || scaling.MaximumScalingStepSize != nil {
+		s += fmt.Sprintf(", step %d-%d", aws.ToInt32(scaling.MinimumScalingStepSize), aws.ToInt32(scaling.MaximumScalingStepSize))
+	}
+	return s
+}
+
+func asgName(asgArn string) string {
+	if _, name, ok := strings.Cut(asgArn, ":autoScalingGroupName/"); ok {
+		return name
+	}
+	return asgArn
+}
+
+// strategySplit returns how many of desired tasks each provider of the strategy runs: bases first, then the
+// rest by weight, with rounding leftovers going to the largest remainders
+func strategySplit(strategy []ectypes.CapacityProviderStrategyItem, desired int32) []int32 {
+	counts := make([]int32, len(strategy))
+
+	remaining := desired
+	var totalWeight int32
+	for i, item := range strategy {
+		base := min(item.Base, remaining)
+		counts[i] += base
+		remaining -= base
+		totalWeight += item.Weight
+	}
+	if remaining == 0 || totalWeight == 0 {
+		return counts
+	}
+
+	remainders := make([]int32, len(strategy))
+	assigned := int32(0)
+	for i, item := range strategy {
+		share := remaining * item.Weight / totalWeight
+		counts[i] += share
+		assigned += share
+		remainders[i] = remaining * item.Weight % totalWeight
+	}
+
+	order := make([]int, len(strategy))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return remainders[order[a]] > remainders[order[b]] })
+	for _, i := range order[:remaining-assigned] {
+		counts[i]++
+	}
+
+	return counts
+}
+
+func printStrategySplit(strategy []ectypes.CapacityProviderStrategyItem, desired int32) {
+	counts := strategySplit(strategy, desired)
+
+	var totalWeight int32
+	for _, item := range strategy {
+		totalWeight += item.Weight
+	}
+
+	fmt.Printf("Expected split of %d desired tasks:\n", desired)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "PROVIDER\tBASE\tWEIGHT\tSHARE\tTASKS")
+	for i, item := range strategy {
+		share := "-"
+		if totalWeight > 0 {
+			share = fmt.Sprintf("%d%%", item.Weight*100/totalWeight)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%d\n", aws.ToString(item.CapacityProvider), item.Base, item.Weight, share, counts[i])
+	}
+	w.Flush()
+}
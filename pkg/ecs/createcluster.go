@@ -0,0 +1,314 @@
+package ecs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsecs "github.com/aws/aws-sdk-go-v2/service/ecs"
+	ectypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/chnacib/nami/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+type CreateClusterOptions struct {
+	Cluster           string
+	Fargate           bool
+	FargateSpot       bool
+	ContainerInsights bool
+	CapacityProviders []string // Auto Scaling group ARNs or existing capacity provider names
+	Strategy          []string // provider[:weight]; default every provider with weight 1
+	Base              int32
+	Tags              map[string]string
+}
+
+// CreateCluster returns the `nami create cluster` command
+func CreateCluster() *cobra.Command {
+	var (
+		opts CreateClusterOptions
+		tags []string
+	)
+
+	cmd := &cobra.Command{
+		Use:     "cluster [name]",
+		Aliases: []string{"clusters"},
+		Short:   "Create an ECS cluster",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.Cluster = args[0]
+
+			opts.Tags = make(map[string]string)
+			for _, kv := range tags {
+				key, value, ok := strings.Cut(kv, "=")
+				if !ok || key == "" {
+					return fmt.Errorf("invalid --tag %q: expected KEY=VALUE", kv)
+				}
+				opts.Tags[key] = value
+			}
+
+			cluster, created, err := createCluster(cmd.Context(), opts)
+			if err != nil {
+				return err
+			}
+
+			if created {
+				fmt.Printf("Cluster %s created\n\n", opts.Cluster)
+			} else {
+				fmt.Printf("Cluster %s already exists with the same settings\n\n", opts.Cluster)
+			}
+			printClusterSummary(cluster)
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().BoolVar(&opts.Fargate, "fargate", false, "Associate the FARGATE capacity provider")
+	cmd.Flags().BoolVar(&opts.FargateSpot, "fargate-spot", false, "Associate the FARGATE_SPOT capacity provider")
+	cmd.Flags().BoolVar(&opts.ContainerInsights, "container-insights", false, "Enable Container Insights")
+	cmd.Flags().StringArrayVar(&opts.CapacityProviders, "capacity-provider", nil, "Auto Scaling group ARN (a capacity provider is created for it) or capacity provider name")
+	cmd.Flags().StringSliceVar(&opts.Strategy, "strategy", nil, "Default capacity provider strategy, e.g. FARGATE_SPOT:3,FARGATE:1 (default every provider with weight 1)")
+	cmd.Flags().Int32Var(&opts.Base, "base", 0, "Tasks to run on the first provider of the default strategy before weights apply")
+	cmd.Flags().StringArrayVar(&tags, "tag", nil, "Cluster tag KEY=VALUE")
+
+	return cmd
+}
+
+// createCluster creates the cluster, or returns the existing one when it already has the requested settings.
+// The bool result reports whether the cluster was created.
+func createCluster(ctx context.Context, opts CreateClusterOptions) (*ectypes.Cluster, bool, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	client := awsecs.NewFromConfig(cfg.AwsConfig)
+
+	var providers []string
+	if opts.Fargate {
+		providers = append(providers, "FARGATE")
+	}
+	if opts.FargateSpot {
+		providers = append(providers, "FARGATE_SPOT")
+	}
+	for _, provider := range opts.CapacityProviders {
+		if !strings.HasPrefix(provider, "arn:") {
+			providers = append(providers, provider)
+			continue
+		}
+		name, err := ensureCapacityProvider(ctx, client, provider, 100)
+		if err != nil {
+			return nil, false, err
+		}
+		providers = append(providers, name)
+	}
+
+	strategy, err := defaultStrategy(providers, opts.Strategy, opts.Base)
+	if err != nil {
+		return nil, false, err
+	}
+
+	insights := "disabled"
+	if opts.ContainerInsights {
+		insights = "enabled"
+	}
+
+	existing, err := client.DescribeClusters(ctx, &awsecs.DescribeClustersInput{
+		Clusters: []string{opts.Cluster},
+		Include:  []ectypes.ClusterField{ectypes.ClusterFieldSettings, ectypes.ClusterFieldTags},
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("describe cluster: %w", err)
+	}
+	for _, c := range existing.Clusters {
+		if aws.ToString(c.Status) != "ACTIVE" {
+			continue
+		}
+
+		if diffs := clusterDiff(c, providers, strategy, insights, opts.Tags); len(diffs) > 0 {
+			return nil, false, fmt.Errorf("cluster %s already exists with different settings:\n  %s", opts.Cluster, strings.Join(diffs, "\n  "))
+		}
+		return &c, false, nil
+	}
+
+	input := &awsecs.CreateClusterInput{
+		ClusterName:                     aws.String(opts.Cluster),
+		CapacityProviders:               providers,
+		DefaultCapacityProviderStrategy: strategy,
+		Settings: []ectypes.ClusterSetting{
+			{Name: ectypes.ClusterSettingNameContainerInsights, Value: aws.String(insights)},
+		},
+	}
+	for key, value := range opts.Tags {
+		input.Tags = append(input.Tags, ectypes.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+
+	out, err := client.CreateCluster(ctx, input)
+	if err != nil {
+		return nil, false, fmt.Errorf("create cluster: %w", err)
+	}
+
+	return out.Cluster, true, nil
+}
+
+// defaultStrategy builds the default capacity provider strategy, every provider with weight 1 unless spec is given
+func defaultStrategy(providers, spec []string, base int32) ([]ectypes.CapacityProviderStrategyItem, error) {
+	if len(spec) == 0 {
+		spec = providers
+	}
+
+	strategy, err := parseCapacityProviderStrategy(spec, base)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range strategy {
+		found := false
+		for _, p := range providers {
+			if p == aws.ToString(item.CapacityProvider) {
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("strategy uses %s, which is not one of the cluster capacity providers", aws.ToString(item.CapacityProvider))
+		}
+	}
+
+	return strategy, nil
+}
+
+// clusterDiff lists the settings where the existing cluster differs from the requested ones. Extra tags on the
+// cluster are not a difference.
+func clusterDiff(c ectypes.Cluster, providers []string, strategy []ectypes.CapacityProviderStrategyItem, insights string, tags map[string]string) []string {
+	var diffs []string
+
+	have := append([]string(nil), c.CapacityProviders...)
+	want := append([]string(nil), providers...)
+	sort.Strings(have)
+	sort.Strings(want)
+	if strings.Join(have, ",") != strings.Join(want, ",") {
+		diffs = append(diffs, fmt.Sprintf("capacity providers: %s, requested %s", listOrNone(have), listOrNone(want)))
+	}
+
+	if formatStrategy(c.DefaultCapacityProviderStrategy) != formatStrategy(strategy) {
+		diffs = append(diffs, fmt.Sprintf("default strategy: %s, requested %s",
+			formatStrategy(c.DefaultCapacityProviderStrategy), formatStrategy(strategy)))
+	}
+
+	current := "disabled"
+	for _, s := range c.Settings {
+		if s.Name == ectypes.ClusterSettingNameContainerInsights {
+			current = aws.ToString(s.Value)
+		}
+	}
+	// "enhanced" observability includes Container Insights
+	if current != insights && !(insights == "enabled" && current == "enhanced") {
+		diffs = append(diffs, fmt.Sprintf("container insights: %s, requested %s", current, insights))
+	}
+
+	existingTags := make(map[string]string)
+	for _, t := range c.Tags {
+		existingTags[aws.ToString(t.Key)] = aws.ToString(t.Value)
+	}
+	var keys []string
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if value, ok := existingTags[key]; !ok || value != tags[key] {
+			diffs = append(diffs, fmt.Sprintf("tag %s: %q, requested %q", key, value, tags[key]))
+		}
+	}
+
+	return diffs
+}
+
+// formatStrategy renders a capacity provider strategy as provider:weight[:base], sorted by provider
+func formatStrategy(strategy []ectypes.CapacityProviderStrategyItem) string {
+	var items []string
+	for _, item := range strategy {
+		entry := fmt.Sprintf("%s:%d", aws.ToString(item.CapacityProvider), item.Weight)
+		if item.Base > 0 {
+			entry += fmt.Sprintf(" (base %d)", item.Base)
+		}
+		items = append(items, entry)
+	}
+	sort.Strings(items)
+	return listOrNone(items)
+}
+
+func listOrNone(items []string) string {
+	if len(items) == 0 {
+		return "none"
+	}
+	return strings.Join(items, ", ")
+}
+
+// ensureCapacityProvider returns the capacity provider of the Auto Scaling group, creating one with managed
+// scaling at targetCapacity when none exists
+func ensureCapacityProvider(ctx context.Context, client *awsecs.Client, asgArn string, targetCapacity int32) (string, error) {
+	var token *string
+	for {
+		out, err := client.DescribeCapacityProviders(ctx, &awsecs.DescribeCapacityProvidersInput{NextToken: token})
+		if err != nil {
+			return "", fmt.Errorf("describe capacity providers: %w", err)
+		}
+
+		for _, cp := range out.CapacityProviders {
+			if cp.Status == ectypes.CapacityProviderStatusActive && cp.AutoScalingGroupProvider != nil &&
+				aws.ToString(cp.AutoScalingGroupProvider.AutoScalingGroupArn) == asgArn {
+				return aws.ToString(cp.Name), nil
+			}
+		}
+
+		if out.NextToken == nil {
+			break
+		}
+		token = out.NextToken
+	}
+
+	cp, err := createCapacityProvider(ctx, client, CreateCapacityProviderOptions{
+		AsgArn: asgArn,
+		ManagedScaling: &ectypes.ManagedScaling{
+			Status:         ectypes.ManagedScalingStatusEnabled,
+			TargetCapacity: aws.Int32(targetCapacity),
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Fprintf(os.Stderr, "Capacity provider %s created for Auto Scaling group %s\n", aws.ToString(cp.Name), asgName(asgArn))
+	return aws.ToString(cp.Name), nil
+}
+
+func printClusterSummary(c *ectypes.Cluster) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+
+	insights := "disabled"
+	for _, s := range c.Settings {
+		if s.Name == ectypes.ClusterSettingNameContainerInsights {
+			insights = aws.ToString(s.Value)
+		}
+	}
+
+	var tags []string
+	for _, t := range c.Tags {
+		tags = append(tags, fmt.Sprintf("%s=%s", aws.ToString(t.Key), aws.ToString(t.Value)))
+	}
+	sort.Strings(tags)
+
+	fmt.Fprintf(w, "Cluster:\t%s\n", aws.ToString(c.ClusterName))
+	fmt.Fprintf(w, "ARN:\t%s\n", aws.ToString(c.ClusterArn))
+	fmt.Fprintf(w, "Status:\t%s\n", aws.ToString(c.Status))
+	fmt.Fprintf(w, "Capacity providers:\t%s\n", listOrNone(c.CapacityProviders))
+	fmt.Fprintf(w, "Default strategy:\t%s\n", formatStrategy(c.DefaultCapacityProviderStrategy))
+	fmt.Fprintf(w, "Container Insights:\t%s\n", insights)
+	fmt.Fprintf(w, "Tags:\t%s\n", listOrNone(tags))
+
+	w.Flush()
+}
@@ -0,0 +1,483 @@
+package ecs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsecs "github.com/aws/aws-sdk-go-v2/service/ecs"
+	ectypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/chnacib/nami/pkg/config"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+type CreateServiceOptions struct {
+	Cluster           string
+	Service           string
+	TaskDefinition    string // family or family:revision
+	Desired           int32
+	Subnets           []string
+	SecurityGroups    []string
+	PublicIP          bool
+	TargetGroups      []string // targetGroupArn:container:port
+	LaunchType        string
+	CapacityProviders []string // provider[:weight]
+	Base              int32    // tasks placed on the first capacity provider before weights apply
+	HealthCheckGrace  int32
+	CircuitBreaker    bool
+	EnableExec        bool
+	Wait              bool
+	Timeout           time.Duration
+	FromFile          string          // CreateService input as JSON or YAML, the other options override its fields
+	Changed           map[string]bool // flags passed explicitly, which take precedence over FromFile
+}
+
+// CreateService returns the `nami create service` command
+func CreateService() *cobra.Command {
+	var (
+		opts       CreateServiceOptions
+		timeoutSec int
+	)
+
+	cmd := &cobra.Command{
+		Use:     "service [name]",
+		Aliases: []string{"svc"},
+		Short:   "Create an ECS service",
+		Args:    cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 0 {
+				opts.Service = args[0]
+			}
+			opts.Timeout = time.Duration(timeoutSec) * time.Second
+
+			opts.Changed = make(map[string]bool)
+			cmd.Flags().Visit(func(f *pflag.Flag) { opts.Changed[f.Name] = true })
+
+			if opts.LaunchType != "" && len(opts.CapacityProviders) > 0 {
+				return errors.New("--launch-type and --capacity-provider cannot be used together")
+			}
+
+			svc, err := createService(cmd.Context(), opts)
+			if err != nil {
+				return err
+			}
+
+			printServiceSummary(svc)
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVarP(&opts.Cluster, "cluster", "c", "", "ECS Cluster name")
+	cmd.Flags().StringVar(&opts.TaskDefinition, "taskdef", "", "Task definition (family or family:revision)")
+	cmd.Flags().StringVarP(&opts.FromFile, "from-file", "f", "", "CreateService input as JSON or YAML (same shape as aws ecs create-service --cli-input-json); flags override its fields")
+	cmd.Flags().Int32VarP(&opts.Desired, "desired", "d", 1, "Desired task count")
+	cmd.Flags().StringSliceVar(&opts.Subnets, "subnets", nil, "Subnets for awsvpc tasks")
+	cmd.Flags().StringSliceVar(&opts.SecurityGroups, "security-groups", nil, "Security groups for awsvpc tasks")
+	cmd.Flags().BoolVar(&opts.PublicIP, "public-ip", false, "Assign a public IP")
+	cmd.Flags().StringArrayVar(&opts.TargetGroups, "target-group", nil, "Register tasks in a target group (targetGroupArn:container:port)")
+	cmd.Flags().StringVar(&opts.LaunchType, "launch-type", "", "FARGATE, EC2 or EXTERNAL (default cluster capacity provider strategy)")
+	cmd.Flags().StringSliceVar(&opts.CapacityProviders, "capacity-provider", nil, "Capacity provider strategy, e.g. FARGATE_SPOT:3,FARGATE:1")
+	cmd.Flags().Int32Var(&opts.Base, "base", 0, "Tasks to run on the first capacity provider before weights apply")
+	cmd.Flags().Int32Var(&opts.HealthCheckGrace, "health-check-grace", 0, "Seconds to ignore load balancer health checks after a task starts")
+	cmd.Flags().BoolVar(&opts.CircuitBreaker, "circuit-breaker", true, "Enable the deployment circuit breaker with rollback")
+	cmd.Flags().BoolVar(&opts.EnableExec, "enable-exec", false, "Enable ECS Exec")
+	cmd.Flags().BoolVar(&opts.Wait, "wait", false, "Wait until the service reaches a steady state")
+	cmd.Flags().IntVar(&timeoutSec, "timeout", 600, "Timeout in seconds for --wait")
+
+	return cmd
+}
+
+func createService(ctx context.Context, opts CreateServiceOptions) (*ectypes.Service, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	client := awsecs.NewFromConfig(cfg.AwsConfig)
+
+	input := &awsecs.CreateServiceInput{}
+	if opts.FromFile != "" {
+		input, err = readServiceInput(opts.FromFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	fromFile := opts.FromFile != ""
+
+	// override reports whether the flag should replace the field, either because it was passed or
+	// because the file left the field unset
+	override := func(flag string, unset bool) bool {
+		return opts.Changed[flag] || unset
+	}
+
+	if opts.Cluster != "" {
+		input.Cluster = aws.String(opts.Cluster)
+	}
+	if opts.Service != "" {
+		input.ServiceName = aws.String(opts.Service)
+	}
+	if opts.TaskDefinition != "" {
+		input.TaskDefinition = aws.String(opts.TaskDefinition)
+	}
+	switch {
+	case aws.ToString(input.Cluster) == "":
+		return nil, errors.New("no cluster: pass --cluster or set cluster in --from-file")
+	case aws.ToString(input.ServiceName) == "":
+		return nil, errors.New("no service name: pass it as an argument or set serviceName in --from-file")
+	case aws.ToString(input.TaskDefinition) == "":
+		return nil, errors.New("no task definition: pass --taskdef or set taskDefinition in --from-file")
+	}
+	opts.Cluster = aws.ToString(input.Cluster)
+	opts.Service = aws.ToString(input.ServiceName)
+
+	tdOut, err := client.DescribeTaskDefinition(ctx, &awsecs.DescribeTaskDefinitionInput{
+		TaskDefinition: input.TaskDefinition,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("describe task definition %q: %w", aws.ToString(input.TaskDefinition), err)
+	}
+	td := tdOut.TaskDefinition
+	input.TaskDefinition = td.TaskDefinitionArn
+
+	if override("desired", input.DesiredCount == nil) {
+		input.DesiredCount = aws.Int32(opts.Desired)
+	}
+	if override("enable-exec", !fromFile) {
+		input.EnableExecuteCommand = opts.EnableExec
+	}
+	if !fromFile {
+		input.EnableECSManagedTags = true
+	}
+	if input.PropagateTags == "" {
+		input.PropagateTags = ectypes.PropagateTagsService
+	}
+	if input.DeploymentConfiguration == nil {
+		input.DeploymentConfiguration = &ectypes.DeploymentConfiguration{}
+	}
+	if override("circuit-breaker", input.DeploymentConfiguration.DeploymentCircuitBreaker == nil) {
+		input.DeploymentConfiguration.DeploymentCircuitBreaker = &ectypes.DeploymentCircuitBreaker{
+			Enable:   opts.CircuitBreaker,
+			Rollback: opts.CircuitBreaker,
+		}
+	}
+
+	if td.NetworkMode == ectypes.NetworkModeAwsvpc {
+		networkSet := input.NetworkConfiguration != nil && input.NetworkConfiguration.AwsvpcConfiguration != nil
+		if !networkSet {
+			input.NetworkConfiguration = &ectypes.NetworkConfiguration{AwsvpcConfiguration: &ectypes.AwsVpcConfiguration{
+				AssignPublicIp: ectypes.AssignPublicIpDisabled,
+			}}
+		}
+		vpc := input.NetworkConfiguration.AwsvpcConfiguration
+		if override("subnets", !networkSet) {
+			vpc.Subnets = opts.Subnets
+		}
+		if override("security-groups", !networkSet) {
+			vpc.SecurityGroups = opts.SecurityGroups
+		}
+		if opts.Changed["public-ip"] {
+			vpc.AssignPublicIp = ectypes.AssignPublicIpDisabled
+			if opts.PublicIP {
+				vpc.AssignPublicIp = ectypes.AssignPublicIpEnabled
+			}
+		}
+		if len(vpc.Subnets) == 0 {
+			return nil, fmt.Errorf("task definition %s uses awsvpc network mode, --subnets is required", NameArn(aws.ToString(td.TaskDefinitionArn)))
+		}
+	} else if len(opts.Subnets) > 0 || len(opts.SecurityGroups) > 0 {
+		return nil, fmt.Errorf("--subnets and --security-groups require a task definition with awsvpc network mode, %s uses %s",
+			NameArn(aws.ToString(td.TaskDefinitionArn)), td.NetworkMode)
+	}
+
+	if opts.Changed["target-group"] {
+		input.LoadBalancers = nil
+		for _, spec := range opts.TargetGroups {
+			lb, err := parseTargetGroup(spec, td)
+			if err != nil {
+				return nil, err
+			}
+			input.LoadBalancers = append(input.LoadBalancers, lb)
+		}
+	}
+	if len(input.LoadBalancers) > 0 && opts.Changed["health-check-grace"] {
+		input.HealthCheckGracePeriodSeconds = aws.Int32(opts.HealthCheckGrace)
+	}
+
+	switch {
+	case opts.LaunchType != "":
+		input.LaunchType = ectypes.LaunchType(strings.ToUpper(opts.LaunchType))
+		input.CapacityProviderStrategy = nil
+	case len(opts.CapacityProviders) > 0:
+		strategy, err := parseCapacityProviderStrategy(opts.CapacityProviders, opts.Base)
+		if err != nil {
+			return nil, err
+		}
+		input.CapacityProviderStrategy = strategy
+		input.LaunchType = ""
+	}
+
+	out, err := client.CreateService(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("create service: %w", err)
+	}
+
+	if !opts.Wait {
+		return out.Service, nil
+	}
+
+	fmt.Fprintf(os.Stderr, "Waiting for %s to reach a steady state...\n", opts.Service)
+
+	describe := &awsecs.DescribeServicesInput{
+		Cluster:  aws.String(opts.Cluster),
+		Services: []string{opts.Service},
+	}
+	if err := awsecs.NewServicesStableWaiter(client).Wait(ctx, describe, opts.Timeout); err != nil {
+		return out.Service, fmt.Errorf("waiting for service to stabilize: %w", err)
+	}
+
+	svcOut, err := client.DescribeServices(ctx, describe)
+	if err != nil {
+		return nil, fmt.Errorf("describe service: %w", err)
+	}
+	if len(svcOut.Services) == 0 {
+		return out.Service, nil
+	}
+
+	return &svcOut.Services[0], nil
+}
+
+// readServiceInput reads a CreateService input from a JSON or YAML file. Keys follow the API, e.g. serviceName
+// and networkConfiguration, and unknown keys are rejected.
+func readServiceInput(path string) (*awsecs.CreateServiceInput, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+
+	// YAML is a superset of JSON, so both are decoded the same way and re-encoded as JSON for the SDK types
+	var doc any
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if doc == nil {
+		return nil, fmt.Errorf("%s is empty", path)
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	var input awsecs.CreateServiceInput
+
+	// encoding/json matches keys case-insensitively, a misspelled key would be silently ignored or misread
+	if err := checkInputKeys(doc, reflect.TypeOf(input), ""); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&input); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	return &input, nil
+}
+
+// checkInputKeys fails on the first key of doc that is not the camelCase name of a field of t, as in
+// `aws ecs create-service --cli-input-json`. Map keys are free-form and not checked.
+func checkInputKeys(doc any, t reflect.Type, path string) error {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		values, ok := doc.(map[string]any)
+		if !ok {
+			return nil // the decoder reports type mismatches
+		}
+
+		fields := make(map[string]reflect.Type)
+		for i := 0; i < t.NumField(); i++ {
+			if f := t.Field(i); f.IsExported() && !f.Anonymous {
+				fields[strings.ToLower(f.Name[:1])+f.Name[1:]] = f.Type
+			}
+		}
+
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			field, ok := fields[key]
+			if !ok {
+				for name := range fields {
+					if strings.EqualFold(name, key) {
+						return fmt.Errorf("unknown key %q, did you mean %q", path+key, path+name)
+					}
+				}
+				return fmt.Errorf("unknown key %q", path+key)
+			}
+			if err := checkInputKeys(values[key], field, path+key+"."); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Slice:
+		items, ok := doc.([]any)
+		if !ok {
+			return nil
+		}
+		for i, item := range items {
+			if err := checkInputKeys(item, t.Elem(), fmt.Sprintf("%s[%d].", strings.TrimSuffix(path, "."), i)); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		values, ok := doc.(map[string]any)
+		if !ok {
+			return nil
+		}
+		for key, value := range values {
+			if err := checkInputKeys(value, t.Elem(), path+key+"."); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseTargetGroup parses targetGroupArn:container:port and checks the container exposes the port
+func parseTargetGroup(spec string, td *ectypes.TaskDefinition) (ectypes.LoadBalancer, error) {
+	var lb ectypes.LoadBalancer
+
+	rest, portStr, ok := cutLast(spec, ":")
+	if !ok {
+		return lb, fmt.Errorf("invalid --target-group %q: expected targetGroupArn:container:port", spec)
+	}
+	arn, container, ok := cutLast(rest, ":")
+	if !ok || !strings.Contains(arn, ":targetgroup/") {
+		return lb, fmt.Errorf("invalid --target-group %q: expected targetGroupArn:container:port", spec)
+	}
+
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return lb, fmt.Errorf("invalid --target-group %q: port %q is not a number", spec, portStr)
+	}
+
+	found := false
+	for _, c := range td.ContainerDefinitions {
+		if aws.ToString(c.Name) != container {
+			continue
+		}
+		for _, pm := range c.PortMappings {
+			if int(aws.ToInt32(pm.ContainerPort)) == port {
+				found = true
+			}
+		}
+		if !found {
+			return lb, fmt.Errorf("container %q does not expose port %d", container, port)
+		}
+	}
+	if !found {
+		return lb, fmt.Errorf("container %q not found in task definition %q", container, NameArn(aws.ToString(td.TaskDefinitionArn)))
+	}
+
+	lb.TargetGroupArn = aws.String(arn)
+	lb.ContainerName = aws.String(container)
+	lb.ContainerPort = aws.Int32(int32(port))
+	return lb, nil
+}
+
+// parseCapacityProviderStrategy parses provider[:weight] entries; base is applied to the first provider
+func parseCapacityProviderStrategy(specs []string, base int32) ([]ectypes.CapacityProviderStrategyItem, error) {
+	var strategy []ectypes.CapacityProviderStrategyItem
+
+	for i, spec := range specs {
+		name, weightStr, hasWeight := strings.Cut(spec, ":")
+		if name == "" {
+			return nil, fmt.Errorf("invalid capacity provider %q", spec)
+		}
+
+		item := ectypes.CapacityProviderStrategyItem{CapacityProvider: aws.String(name), Weight: 1}
+		if hasWeight {
+			weight, err := strconv.Atoi(weightStr)
+			if err != nil || weight < 0 || weight > 1000 {
+				return nil, fmt.Errorf("invalid weight in %q: expected 0-1000", spec)
+			}
+			item.Weight = int32(weight)
+		}
+		if i == 0 {
+			item.Base = base
+		}
+
+		strategy = append(strategy, item)
+	}
+
+	return strategy, nil
+}
+
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+func printServiceSummary(svc *ectypes.Service) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+
+	fmt.Fprintf(w, "Service:\t%s\n", aws.ToString(svc.ServiceName))
+	fmt.Fprintf(w, "ARN:\t%s\n", aws.ToString(svc.ServiceArn))
+	fmt.Fprintf(w, "Status:\t%s\n", aws.ToString(svc.Status))
+	fmt.Fprintf(w, "Task definition:\t%s\n", NameArn(aws.ToString(svc.TaskDefinition)))
+	fmt.Fprintf(w, "Tasks:\t%d running, %d pending, %d desired\n", svc.RunningCount, svc.PendingCount, svc.DesiredCount)
+
+	if len(svc.CapacityProviderStrategy) > 0 {
+		var items []string
+		for _, item := range svc.CapacityProviderStrategy {
+			entry := fmt.Sprintf("%s:%d", aws.ToString(item.CapacityProvider), item.Weight)
+			if item.Base > 0 {
+				entry += fmt.Sprintf(" (base %d)", item.Base)
+			}
+			items = append(items, entry)
+		}
+		fmt.Fprintf(w, "Capacity providers:\t%s\n", strings.Join(items, ", "))
+	} else if svc.LaunchType != "" {
+		fmt.Fprintf(w, "Launch type:\t%s\n", svc.LaunchType)
+	}
+
+	if nc := svc.NetworkConfiguration; nc != nil && nc.AwsvpcConfiguration != nil {
+		fmt.Fprintf(w, "Subnets:\t%s\n", strings.Join(nc.AwsvpcConfiguration.Subnets, ", "))
+		fmt.Fprintf(w, "Security groups:\t%s\n", strings.Join(nc.AwsvpcConfiguration.SecurityGroups, ", "))
+		fmt.Fprintf(w, "Public IP:\t%s\n", nc.AwsvpcConfiguration.AssignPublicIp)
+	}
+
+	for _, lb := range svc.LoadBalancers {
+		fmt.Fprintf(w, "Target group:\t%s -> %s:%d\n", extractTargetGroupID(aws.ToString(lb.TargetGroupArn)), aws.ToString(lb.ContainerName), aws.ToInt32(lb.ContainerPort))
+	}
+
+	if dc := svc.DeploymentConfiguration; dc != nil && dc.DeploymentCircuitBreaker != nil {
+		cb := dc.DeploymentCircuitBreaker
+		fmt.Fprintf(w, "Circuit breaker:\tenabled=%t rollback=%t\n", cb.Enable, cb.Rollback)
+	}
+
+	w.Flush()
+}
@@ -0,0 +1,45 @@
+package ecs
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	awsecs "github.com/aws/aws-sdk-go-v2/service/ecs"
+	"gopkg.in/yaml.v3"
+)
+
+func TestCheckInputKeys(t *testing.T) {
+	tests := []struct {
+		doc     string
+		wantErr string
+	}{
+		{doc: "serviceName: web\ndesiredCount: 2"},
+		{doc: "loadBalancers:\n  - targetGroupArn: arn\n    containerName: web\n    containerPort: 80"},
+		{doc: "networkConfiguration:\n  awsvpcConfiguration:\n    subnets: [subnet-1]\n    assignPublicIp: DISABLED"},
+		{doc: "enableECSManagedTags: true\ntags:\n  - key: team\n    value: web"},
+		{doc: "serviceName: web\ndesiredcount: 2", wantErr: `unknown key "desiredcount", did you mean "desiredCount"`},
+		{doc: "ServiceName: web", wantErr: `unknown key "ServiceName", did you mean "serviceName"`},
+		{doc: "serviceNmae: web", wantErr: `unknown key "serviceNmae"`},
+		{doc: "loadBalancers:\n  - targetGroupArn: arn\n    containerport: 80", wantErr: `unknown key "loadBalancers[0].containerport"`},
+		{doc: "networkConfiguration:\n  awsvpcConfiguration:\n    subnet: [subnet-1]", wantErr: `unknown key "networkConfiguration.awsvpcConfiguration.subnet"`},
+	}
+
+	for _, tt := range tests {
+		var doc any
+		if err := yaml.Unmarshal([]byte(tt.doc), &doc); err != nil {
+			t.Fatalf("yaml %q: %v", tt.doc, err)
+		}
+
+		err := checkInputKeys(doc, reflect.TypeOf(awsecs.CreateServiceInput{}), "")
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("checkInputKeys(%q) returned error: %v", tt.doc, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("checkInputKeys(%q) = %v, want %s", tt.doc, err, tt.wantErr)
+		}
+	}
+}
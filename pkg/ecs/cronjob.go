@@ -0,0 +1,427 @@
+package ecs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsecs "github.com/aws/aws-sdk-go-v2/service/ecs"
+	ectypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/aws-sdk-go-v2/service/scheduler"
+	schedtypes "github.com/aws/aws-sdk-go-v2/service/scheduler/types"
+	"github.com/chnacib/nami/pkg/config"
+	"github.com/chnacib/nami/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+type CronJobOptions struct {
+	RunOptions
+	Name     string
+	Cron     string // 5-field cron, or a cron()/rate()/at() expression
+	Timezone string
+	Role     string // IAM role EventBridge Scheduler assumes to call ecs:RunTask
+	Group    string // schedule group
+	Disabled bool
+}
+
+// cronJobOverrides is the RunTask overrides document EventBridge Scheduler sends as the target input
+type cronJobOverrides struct {
+	ContainerOverrides []cronJobContainerOverride `json:"containerOverrides"`
+}
+
+type cronJobContainerOverride struct {
+	Name        string               `json:"name"`
+	Command     []string             `json:"command,omitempty"`
+	Environment []cronJobEnvOverride `json:"environment,omitempty"`
+}
+
+type cronJobEnvOverride struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// CreateCronJob returns the `nami create cronjob` command
+func CreateCronJob() *cobra.Command {
+	var (
+		opts    CronJobOptions
+		command string
+		env     []string
+	)
+
+	cmd := &cobra.Command{
+		Use:     "cronjob [name]",
+		Aliases: []string{"cronjobs", "cj"},
+		Short:   "Schedule a task with EventBridge Scheduler",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.Name = args[0]
+
+			switch {
+			case opts.Target == "" && opts.FromService == "":
+				return errors.New("one of --taskdef or --from-service is required")
+			case opts.Target == "":
+				opts.Target = "svc/" + opts.FromService
+			}
+
+			if command != "" {
+				args, err := utils.SplitArgs(command)
+				if err != nil {
+					return err
+				}
+				opts.Command = args
+			}
+			opts.Env = make(map[string]string)
+			for _, kv := range env {
+				name, value, ok := strings.Cut(kv, "=")
+				if !ok {
+					return fmt.Errorf("invalid --env %q: expected KEY=VALUE", kv)
+				}
+				opts.Env[name] = value
+			}
+
+			arn, err := createCronJob(cmd.Context(), opts)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Cronjob %s created (%s)\n", opts.Name, arn)
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVarP(&opts.Cluster, "cluster", "c", "", "ECS Cluster name")
+	cmd.MarkFlagRequired("cluster")
+	cmd.Flags().StringVar(&opts.Target, "taskdef", "", "Task definition (family runs the latest revision, family:revision pins it)")
+	cmd.Flags().StringVar(&opts.FromService, "from-service", "", "Inherit task definition family, network configuration and launch type from this service")
+	cmd.Flags().StringVar(&opts.Cron, "cron", "", "Cron expression, e.g. \"0 3 * * *\" or rate(1 hour)")
+	cmd.MarkFlagRequired("cron")
+	cmd.Flags().StringVar(&opts.Timezone, "timezone", "UTC", "Timezone the cron expression is evaluated in")
+	cmd.Flags().StringVar(&opts.Role, "role", "", "ARN of the IAM role EventBridge Scheduler uses to run the task")
+	cmd.MarkFlagRequired("role")
+	cmd.Flags().StringVar(&opts.Group, "group", "default", "EventBridge Scheduler schedule group")
+	cmd.Flags().BoolVar(&opts.Disabled, "disabled", false, "Create the schedule disabled")
+	cmd.Flags().StringVar(&opts.Container, "container", "", "Container to override (default first essential container)")
+	cmd.Flags().StringVar(&command, "command", "", "Command override, split like a shell command line")
+	cmd.Flags().StringArrayVarP(&env, "env", "e", nil, "Environment override KEY=VALUE")
+	cmd.Flags().StringSliceVar(&opts.Subnets, "subnets", nil, "Subnets for awsvpc tasks")
+	cmd.Flags().StringSliceVar(&opts.SecurityGroups, "security-groups", nil, "Security groups for awsvpc tasks")
+	cmd.Flags().BoolVar(&opts.PublicIP, "public-ip", false, "Assign a public IP")
+	cmd.Flags().StringVar(&opts.LaunchType, "launch-type", "", "FARGATE, EC2 or EXTERNAL (default inherited or cluster default)")
+
+	return cmd
+}
+
+// DeleteCronJob returns the `nami delete cronjob` command
+func DeleteCronJob() *cobra.Command {
+	var group string
+
+	cmd := &cobra.Command{
+		Use:     "cronjob [name]",
+		Aliases: []string{"cronjobs", "cj"},
+		Short:   "Delete a scheduled task",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+
+			cfg, err := config.LoadConfig()
+			if err != nil {
+				return fmt.Errorf("failed to load configuration: %w", err)
+			}
+
+			client := scheduler.NewFromConfig(cfg.AwsConfig)
+
+			// Only delete schedules that run ECS tasks
+			if _, err := getCronJob(cmd.Context(), client, name, group); err != nil {
+				return err
+			}
+
+			_, err = client.DeleteSchedule(cmd.Context(), &scheduler.DeleteScheduleInput{
+				Name:      aws.String(name),
+				GroupName: aws.String(group),
+			})
+			if err != nil {
+				return fmt.Errorf("delete schedule: %w", err)
+			}
+
+			fmt.Printf("Cronjob %s deleted\n", name)
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVar(&group, "group", "default", "EventBridge Scheduler schedule group")
+
+	return cmd
+}
+
+// TriggerCronJob returns the `nami cronjob trigger` command
+func TriggerCronJob() *cobra.Command {
+	var (
+		group      string
+		follow     bool
+		timeoutSec int
+	)
+
+	cmd := &cobra.Command{
+		Use:   "trigger [name]",
+		Short: "Run a scheduled task now",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			exitCode, err := triggerCronJob(cmd.Context(), args[0], group, follow, time.Duration(timeoutSec)*time.Second)
+			if err != nil {
+				return err
+			}
+
+			if exitCode != 0 {
+				os.Exit(exitCode)
+			}
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVar(&group, "group", "default", "EventBridge Scheduler schedule group")
+	cmd.Flags().BoolVarP(&follow, "follow", "f", false, "Stream the task logs and exit with its exit code")
+	cmd.Flags().IntVar(&timeoutSec, "timeout", 3600, "Seconds to wait for the task to stop with --follow")
+
+	return cmd
+}
+
+// createCronJob creates an EventBridge Scheduler schedule that runs the task in the cluster and returns its ARN
+func createCronJob(ctx context.Context, opts CronJobOptions) (string, error) {
+	expression, err := awsSchedule(opts.Cron)
+	if err != nil {
+		return "", err
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return "", fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	client := awsecs.NewFromConfig(cfg.AwsConfig)
+
+	clusters, err := client.DescribeClusters(ctx, &awsecs.DescribeClustersInput{Clusters: []string{opts.Cluster}})
+	if err != nil {
+		return "", fmt.Errorf("describe cluster: %w", err)
+	}
+	if len(clusters.Clusters) == 0 || aws.ToString(clusters.Clusters[0].Status) != "ACTIVE" {
+		return "", fmt.Errorf("cluster %q not found", opts.Cluster)
+	}
+
+	input, td, container, err := runTaskInput(ctx, client, opts.RunOptions)
+	if err != nil {
+		return "", err
+	}
+
+	// Without an explicit revision the schedule follows the latest ACTIVE revision of the family
+	taskDefinitionArn := aws.ToString(td.TaskDefinitionArn)
+	if !strings.Contains(NameArn(opts.Target), ":") {
+		taskDefinitionArn = strings.TrimSuffix(taskDefinitionArn, fmt.Sprintf(":%d", td.Revision))
+	}
+
+	params := &schedtypes.EcsParameters{
+		TaskDefinitionArn:    aws.String(taskDefinitionArn),
+		TaskCount:            aws.Int32(1),
+		Group:                aws.String(cronJobGroup(opts.Name)),
+		LaunchType:           schedtypes.LaunchType(input.LaunchType),
+		PlatformVersion:      input.PlatformVersion,
+		EnableECSManagedTags: aws.Bool(true),
+	}
+	if input.PropagateTags == ectypes.PropagateTagsTaskDefinition {
+		params.PropagateTags = schedtypes.PropagateTagsTaskDefinition
+	}
+	for _, item := range input.CapacityProviderStrategy {
+		params.CapacityProviderStrategy = append(params.CapacityProviderStrategy, schedtypes.CapacityProviderStrategyItem{
+			CapacityProvider: item.CapacityProvider,
+			Base:             item.Base,
+			Weight:           item.Weight,
+		})
+	}
+	if input.NetworkConfiguration != nil && input.NetworkConfiguration.AwsvpcConfiguration != nil {
+		vpc := input.NetworkConfiguration.AwsvpcConfiguration
+		params.NetworkConfiguration = &schedtypes.NetworkConfiguration{
+			AwsvpcConfiguration: &schedtypes.AwsVpcConfiguration{
+				Subnets:        vpc.Subnets,
+				SecurityGroups: vpc.SecurityGroups,
+				AssignPublicIp: schedtypes.AssignPublicIp(vpc.AssignPublicIp),
+			},
+		}
+	}
+
+	target := &schedtypes.Target{
+		Arn:           clusters.Clusters[0].ClusterArn,
+		RoleArn:       aws.String(opts.Role),
+		EcsParameters: params,
+	}
+	if input.Overrides != nil {
+		override := cronJobContainerOverride{Name: aws.ToString(container.Name), Command: opts.Command}
+		for name, value := range opts.Env {
+			override.Environment = append(override.Environment, cronJobEnvOverride{Name: name, Value: value})
+		}
+		doc, err := json.Marshal(cronJobOverrides{ContainerOverrides: []cronJobContainerOverride{override}})
+		if err != nil {
+			return "", err
+		}
+		target.Input = aws.String(string(doc))
+	}
+
+	state := schedtypes.ScheduleStateEnabled
+	if opts.Disabled {
+		state = schedtypes.ScheduleStateDisabled
+	}
+
+	out, err := scheduler.NewFromConfig(cfg.AwsConfig).CreateSchedule(ctx, &scheduler.CreateScheduleInput{
+		Name:                       aws.String(opts.Name),
+		GroupName:                  aws.String(opts.Group),
+		ScheduleExpression:         aws.String(expression),
+		ScheduleExpressionTimezone: aws.String(opts.Timezone),
+		FlexibleTimeWindow:         &schedtypes.FlexibleTimeWindow{Mode: schedtypes.FlexibleTimeWindowModeOff},
+		State:                      state,
+		Description:                aws.String(fmt.Sprintf("nami cronjob %s in cluster %s", opts.Name, opts.Cluster)),
+		Target:                     target,
+	})
+	if err != nil {
+		var conflict *schedtypes.ConflictException
+		if errors.As(err, &conflict) {
+			return "", fmt.Errorf("cronjob %q already exists in group %q", opts.Name, opts.Group)
+		}
+		return "", fmt.Errorf("create schedule: %w", err)
+	}
+
+	if err := ensureCronJobHistory(ctx, cfg.AwsConfig, aws.ToString(clusters.Clusters[0].ClusterArn)); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: cronjob runs will not be recorded: %v\n", err)
+	}
+
+	return aws.ToString(out.ScheduleArn), nil
+}
+
+// triggerCronJob runs the schedule's task once, outside of its schedule
+func triggerCronJob(ctx context.Context, name, group string, follow bool, timeout time.Duration) (int, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return 1, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	schedule, err := getCronJob(ctx, scheduler.NewFromConfig(cfg.AwsConfig), name, group)
+	if err != nil {
+		return 1, err
+	}
+
+	params := schedule.Target.EcsParameters
+	cluster := NameArn(aws.ToString(schedule.Target.Arn))
+
+	input := &awsecs.RunTaskInput{
+		Cluster:              aws.String(cluster),
+		TaskDefinition:       params.TaskDefinitionArn,
+		Count:                aws.Int32(1),
+		Group:                params.Group,
+		StartedBy:            aws.String("nami"),
+		LaunchType:           ectypes.LaunchType(params.LaunchType),
+		PlatformVersion:      params.PlatformVersion,
+		EnableECSManagedTags: aws.ToBool(params.EnableECSManagedTags),
+		PropagateTags:        ectypes.PropagateTags(params.PropagateTags),
+	}
+	if input.Group == nil {
+		input.Group = aws.String("family:" + utils.ParseTaskFamily(aws.ToString(params.TaskDefinitionArn)))
+	}
+	for _, item := range params.CapacityProviderStrategy {
+		input.CapacityProviderStrategy = append(input.CapacityProviderStrategy, ectypes.CapacityProviderStrategyItem{
+			CapacityProvider: item.CapacityProvider,
+			Base:             item.Base,
+			Weight:           item.Weight,
+		})
+	}
+	if params.NetworkConfiguration != nil && params.NetworkConfiguration.AwsvpcConfiguration != nil {
+		vpc := params.NetworkConfiguration.AwsvpcConfiguration
+		input.NetworkConfiguration = &ectypes.NetworkConfiguration{
+			AwsvpcConfiguration: &ectypes.AwsVpcConfiguration{
+				Subnets:        vpc.Subnets,
+				SecurityGroups: vpc.SecurityGroups,
+				AssignPublicIp: ectypes.AssignPublicIp(vpc.AssignPublicIp),
+			},
+		}
+	}
+
+	containerName := ""
+	if doc := aws.ToString(schedule.Target.Input); doc != "" {
+		var overrides cronJobOverrides
+		if err := json.Unmarshal([]byte(doc), &overrides); err != nil {
+			return 1, fmt.Errorf("cronjob %q has an input that is not a task override: %w", name, err)
+		}
+
+		input.Overrides = &ectypes.TaskOverride{}
+		for _, o := range overrides.ContainerOverrides {
+			override := ectypes.ContainerOverride{Name: aws.String(o.Name), Command: o.Command}
+			for _, e := range o.Environment {
+				override.Environment = append(override.Environment, ectypes.KeyValuePair{Name: aws.String(e.Name), Value: aws.String(e.Value)})
+			}
+			input.Overrides.ContainerOverrides = append(input.Overrides.ContainerOverrides, override)
+			if containerName == "" {
+				containerName = o.Name
+			}
+		}
+	}
+
+	client := awsecs.NewFromConfig(cfg.AwsConfig)
+
+	runOut, err := client.RunTask(ctx, input)
+	if err != nil {
+		return 1, fmt.Errorf("run task: %w", err)
+	}
+	for _, failure := range runOut.Failures {
+		return 1, fmt.Errorf("run task failed: %s (%s)", aws.ToString(failure.Reason), aws.ToString(failure.Detail))
+	}
+	if len(runOut.Tasks) == 0 {
+		return 1, errors.New("run task returned no task")
+	}
+
+	task := runOut.Tasks[0]
+	fmt.Printf("Cronjob %s triggered, task %s (%s)\n", name, NameArn(aws.ToString(task.TaskArn)), NameArn(aws.ToString(task.TaskDefinitionArn)))
+	if !follow {
+		return 0, nil
+	}
+
+	tdOut, err := client.DescribeTaskDefinition(ctx, &awsecs.DescribeTaskDefinitionInput{TaskDefinition: task.TaskDefinitionArn})
+	if err != nil {
+		return 1, fmt.Errorf("describe task definition: %w", err)
+	}
+	container, err := runContainer(tdOut.TaskDefinition, containerName)
+	if err != nil {
+		return 1, err
+	}
+
+	return followTask(ctx, cfg.AwsConfig, client, cluster, aws.ToString(task.TaskArn), container, timeout)
+}
+
+// getCronJob returns the schedule, failing when it does not run an ECS task
+func getCronJob(ctx context.Context, client *scheduler.Client, name, group string) (*scheduler.GetScheduleOutput, error) {
+	schedule, err := client.GetSchedule(ctx, &scheduler.GetScheduleInput{
+		Name:      aws.String(name),
+		GroupName: aws.String(group),
+	})
+	if err != nil {
+		var notFound *schedtypes.ResourceNotFoundException
+		if errors.As(err, &notFound) {
+			return nil, fmt.Errorf("cronjob %q not found in group %q", name, group)
+		}
+		return nil, fmt.Errorf("get schedule: %w", err)
+	}
+
+	if schedule.Target == nil || schedule.Target.EcsParameters == nil {
+		return nil, fmt.Errorf("schedule %q does not run an ECS task", name)
+	}
+
+	return schedule, nil
+}
+
+// cronJobGroup is the ECS task group of the cronjob's tasks, used to find its last run
+func cronJobGroup(name string) string {
+	return "cronjob:" + name
+}
@@ -0,0 +1,168 @@
+package ecs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	logtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	ectypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	ebtypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/chnacib/nami/pkg/cw"
+)
+
+// ECS only keeps stopped tasks for about an hour, so the RUNNING and STOPPED state changes of cronjob tasks
+// are sent by an EventBridge rule to this log group, where the last run of each cronjob is read from
+const (
+	cronJobHistoryLogGroup  = "/nami/cronjobs"
+	cronJobHistoryRetention = 30 // days
+)
+
+// cronJobTaskEvent is the part of an ECS Task State Change event used to report a run
+type cronJobTaskEvent struct {
+	Detail struct {
+		Group         string     `json:"group"`
+		LastStatus    string     `json:"lastStatus"`
+		StopCode      string     `json:"stopCode"`
+		StoppedReason string     `json:"stoppedReason"`
+		CreatedAt     *time.Time `json:"createdAt"`
+		Containers    []struct {
+			Name     string `json:"name"`
+			ExitCode *int32 `json:"exitCode"`
+		} `json:"containers"`
+	} `json:"detail"`
+}
+
+// ensureCronJobHistory creates the history log group and the rule sending the state changes of the
+// cluster's cronjob tasks to it. Every call converges to the same resources.
+func ensureCronJobHistory(ctx context.Context, cfg aws.Config, clusterArn string) error {
+	parts := strings.Split(clusterArn, ":")
+	if len(parts) < 6 {
+		return fmt.Errorf("invalid cluster ARN %q", clusterArn)
+	}
+	partition, region, account := parts[1], parts[3], parts[4]
+	logGroupArn := fmt.Sprintf("arn:%s:logs:%s:%s:log-group:%s", partition, region, account, cronJobHistoryLogGroup)
+
+	logs := cloudwatchlogs.NewFromConfig(cfg)
+
+	_, err := logs.CreateLogGroup(ctx, &cloudwatchlogs.CreateLogGroupInput{LogGroupName: aws.String(cronJobHistoryLogGroup)})
+	var exists *logtypes.ResourceAlreadyExistsException
+	if err != nil && !errors.As(err, &exists) {
+		return fmt.Errorf("create log group %s: %w", cronJobHistoryLogGroup, err)
+	}
+	if err == nil {
+		_, err = logs.PutRetentionPolicy(ctx, &cloudwatchlogs.PutRetentionPolicyInput{
+			LogGroupName:    aws.String(cronJobHistoryLogGroup),
+			RetentionInDays: aws.Int32(cronJobHistoryRetention),
+		})
+		if err != nil {
+			return fmt.Errorf("set retention of %s: %w", cronJobHistoryLogGroup, err)
+		}
+	}
+
+	// EventBridge writes to CloudWatch Logs through the log group resource policy
+	policy, err := json.Marshal(map[string]interface{}{
+		"Version": "2012-10-17",
+		"Statement": []map[string]interface{}{{
+			"Effect":    "Allow",
+			"Principal": map[string][]string{"Service": {"events.amazonaws.com", "delivery.logs.amazonaws.com"}},
+			"Action":    []string{"logs:CreateLogStream", "logs:PutLogEvents"},
+			"Resource":  logGroupArn + ":*",
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = logs.PutResourcePolicy(ctx, &cloudwatchlogs.PutResourcePolicyInput{
+		PolicyName:     aws.String("nami-cronjobs"),
+		PolicyDocument: aws.String(string(policy)),
+	})
+	if err != nil {
+		return fmt.Errorf("put log resource policy: %w", err)
+	}
+
+	pattern, err := json.Marshal(map[string]interface{}{
+		"source":      []string{"aws.ecs"},
+		"detail-type": []string{"ECS Task State Change"},
+		"detail": map[string]interface{}{
+			"clusterArn": []string{clusterArn},
+			"group":      []map[string]string{{"prefix": cronJobGroup("")}},
+			"lastStatus": []string{"RUNNING", "STOPPED"},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	events := eventbridge.NewFromConfig(cfg)
+	rule := cronJobHistoryRule(clusterArn)
+
+	_, err = events.PutRule(ctx, &eventbridge.PutRuleInput{
+		Name:         aws.String(rule),
+		EventPattern: aws.String(string(pattern)),
+		State:        ebtypes.RuleStateEnabled,
+		Description:  aws.String("nami cronjob runs in " + NameArn(clusterArn)),
+	})
+	if err != nil {
+		return fmt.Errorf("put rule %s: %w", rule, err)
+	}
+
+	out, err := events.PutTargets(ctx, &eventbridge.PutTargetsInput{
+		Rule:    aws.String(rule),
+		Targets: []ebtypes.Target{{Id: aws.String("history"), Arn: aws.String(logGroupArn)}},
+	})
+	if err != nil {
+		return fmt.Errorf("put targets on rule %s: %w", rule, err)
+	}
+	for _, failure := range out.FailedEntries {
+		return fmt.Errorf("put targets on rule %s: %s", rule, aws.ToString(failure.ErrorMessage))
+	}
+
+	return nil
+}
+
+// cronJobHistoryRule is the EventBridge rule name for the cluster, rule names are limited to 64 characters
+func cronJobHistoryRule(clusterArn string) string {
+	name := "nami-cronjobs-" + NameArn(clusterArn)
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
+
+// cronJobHistory returns the latest recorded run of each cronjob task group in the cluster
+func cronJobHistory(ctx context.Context, cfg aws.Config, clusterArn string) (map[string]ectypes.Task, error) {
+	start := time.Now().AddDate(0, 0, -cronJobHistoryRetention)
+	messages, err := cw.LatestMessages(ctx, cfg, cronJobHistoryLogGroup, fmt.Sprintf("detail.clusterArn = %q", clusterArn), "detail.group", start)
+	if err != nil {
+		return nil, err
+	}
+
+	runs := make(map[string]ectypes.Task, len(messages))
+	for group, message := range messages {
+		var event cronJobTaskEvent
+		if err := json.Unmarshal([]byte(message), &event); err != nil {
+			continue
+		}
+
+		task := ectypes.Task{
+			Group:         aws.String(event.Detail.Group),
+			LastStatus:    aws.String(event.Detail.LastStatus),
+			StopCode:      ectypes.TaskStopCode(event.Detail.StopCode),
+			StoppedReason: aws.String(event.Detail.StoppedReason),
+			CreatedAt:     event.Detail.CreatedAt,
+		}
+		for _, c := range event.Detail.Containers {
+			task.Containers = append(task.Containers, ectypes.Container{Name: aws.String(c.Name), ExitCode: c.ExitCode})
+		}
+		runs[group] = task
+	}
+
+	return runs, nil
+}
@@ -1,49 +1,398 @@
 package ecs
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"os"
+	"strings"
+	"sync"
+	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsecs "github.com/aws/aws-sdk-go-v2/service/ecs"
+	ectypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
+	elbtypes "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2/types"
+	"github.com/chnacib/nami/pkg/config"
+	"github.com/chnacib/nami/pkg/utils"
 	"github.com/spf13/cobra"
 )
 
+type DeleteTaskOptions struct {
+	Cluster     string
+	Tasks       []string // task IDs or ARNs; when empty, tasks are selected from Service
+	Service     string
+	Revision    int // only tasks running this task definition revision
+	OlderThan   time.Duration
+	All         bool
+	MaxParallel int
+	MinHealthy  int // -1 uses the service minimumHealthyPercent
+	Timeout     time.Duration
+}
+
 func DeleteTask() *cobra.Command {
-	var cluster string
-	var task string
+	var (
+		opts       DeleteTaskOptions
+		olderThan  string
+		yes        bool
+		timeoutSec int
+	)
+
 	cmd := &cobra.Command{
-		Use:     "task",
+		Use:     "task [task...]",
 		Aliases: []string{"tsk", "tasks"},
-		Short:   "Stop ECS running task",
-		Run: func(cmd *cobra.Command, args []string) {
-			task = args[0]
-			sess := session.Must(session.NewSessionWithOptions(session.Options{
-				SharedConfigState: session.SharedConfigEnable,
-			}))
-
-			client := ecs.New(sess)
-
-			input := &ecs.StopTaskInput{
-				Task:    aws.String(task),
-				Cluster: aws.String(cluster),
-				Reason:  aws.String("Stopped by nami"),
-			}
-
-			_, err := client.StopTask(input)
+		Short:   "Stop ECS running tasks, draining them from their target groups first",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.Tasks = args
+			opts.Timeout = time.Duration(timeoutSec) * time.Second
 
-			if err != nil {
-				fmt.Println(err)
-				os.Exit(0)
+			if olderThan != "" {
+				d, err := utils.ParseDuration(olderThan)
+				if err != nil {
+					return err
+				}
+				opts.OlderThan = d
 			}
 
-			fmt.Printf("Task %s stopped\n", task)
+			switch {
+			case len(args) == 0 && opts.Service == "":
+				return errors.New("pass task IDs or --service")
+			case len(args) == 0 && !opts.All && opts.Revision == 0 && opts.OlderThan == 0:
+				return errors.New("select tasks with --revision, --older-than or --all")
+			case opts.MaxParallel < 1:
+				return errors.New("--max-parallel must be at least 1")
+			}
 
+			return deleteTasks(cmd.Context(), opts, yes)
 		},
+		SilenceUsage: true,
 	}
-	cmd.Flags().StringVarP(&cluster, "cluster", "c", "string", "ECS task name")
+
+	cmd.Flags().StringVarP(&opts.Cluster, "cluster", "c", "", "ECS Cluster name")
 	cmd.MarkFlagRequired("cluster")
+	cmd.Flags().StringVarP(&opts.Service, "service", "s", "", "Stop tasks of this service")
+	cmd.Flags().IntVarP(&opts.Revision, "revision", "r", 0, "Only tasks running this task definition revision")
+	cmd.Flags().StringVar(&olderThan, "older-than", "", "Only tasks started longer ago than this (e.g. 2h, 7d)")
+	cmd.Flags().BoolVar(&opts.All, "all", false, "All tasks of the service")
+	cmd.Flags().IntVar(&opts.MaxParallel, "max-parallel", 1, "Tasks stopped at the same time")
+	cmd.Flags().IntVar(&opts.MinHealthy, "min-healthy", -1, "Running tasks to keep (default stop as many as the service maximumPercent can replace, at least 1)")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Skip the confirmation prompt")
+	cmd.Flags().IntVar(&timeoutSec, "timeout", 900, "Seconds to wait for each batch to drain and be replaced")
 
 	return cmd
 }
+
+// deleteTasks stops the selected tasks in batches the service can replace
+func deleteTasks(ctx context.Context, opts DeleteTaskOptions, yes bool) error {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	client := awsecs.NewFromConfig(cfg.AwsConfig)
+	elb := elasticloadbalancingv2.NewFromConfig(cfg.AwsConfig)
+
+	tasks, err := selectTasks(ctx, client, opts)
+	if err != nil {
+		return err
+	}
+	if len(tasks) == 0 {
+		fmt.Println("No tasks match")
+		return nil
+	}
+
+	// Tasks are stopped per service so each service's batches fit what it can replace
+	byService := make(map[string][]ectypes.Task)
+	var order []string
+	for _, task := range tasks {
+		service := strings.TrimPrefix(aws.ToString(task.Group), "service:")
+		if !strings.HasPrefix(aws.ToString(task.Group), "service:") {
+			service = ""
+		}
+		if _, ok := byService[service]; !ok {
+			order = append(order, service)
+		}
+		byService[service] = append(byService[service], task)
+	}
+
+	fmt.Printf("%d tasks will be stopped:\n", len(tasks))
+	for _, task := range tasks {
+		fmt.Printf("  %s\t%s\t%s\n", NameArn(aws.ToString(task.TaskArn)), NameArn(aws.ToString(task.TaskDefinitionArn)), aws.ToString(task.Group))
+	}
+
+	// A single task picked by ID is stopped right away, selections that can match many tasks are confirmed
+	bulk := opts.Service != "" || opts.Revision != 0 || opts.OlderThan > 0 || len(tasks) > 1
+	if bulk && !yes && !utils.Confirm("Continue? [y/N] ", "y") {
+		return errors.New("no tasks stopped")
+	}
+
+	for _, service := range order {
+		if err := stopServiceTasks(ctx, client, elb, opts, service, byService[service]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// selectTasks describes the tasks passed by ID, or the service tasks matching the filters
+func selectTasks(ctx context.Context, client *awsecs.Client, opts DeleteTaskOptions) ([]ectypes.Task, error) {
+	var found []ectypes.Task
+	var err error
+	if len(opts.Tasks) == 0 {
+		found, err = serviceTasks(ctx, client, opts.Cluster, opts.Service, ectypes.DesiredStatusRunning)
+	} else {
+		found, err = describeTasks(ctx, client, opts.Cluster, opts.Tasks)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var tasks []ectypes.Task
+	for _, task := range found {
+		if opts.Revision != 0 && !strings.HasSuffix(aws.ToString(task.TaskDefinitionArn), fmt.Sprintf(":%d", opts.Revision)) {
+			continue
+		}
+		if opts.OlderThan > 0 && (task.StartedAt == nil || time.Since(*task.StartedAt) < opts.OlderThan) {
+			continue
+		}
+		tasks = append(tasks, task)
+	}
+
+	return tasks, nil
+}
+
+// stopServiceTasks stops tasks of one service (or standalone tasks when service is empty) in batches
+func stopServiceTasks(ctx context.Context, client *awsecs.Client, elb *elasticloadbalancingv2.Client, opts DeleteTaskOptions, service string, tasks []ectypes.Task) error {
+	if service == "" {
+		return stopTaskBatch(ctx, client, elb, opts.Cluster, nil, tasks, opts.MaxParallel, opts.Timeout)
+	}
+
+	svc, err := describeService(ctx, client, opts.Cluster, service)
+	if err != nil {
+		return err
+	}
+
+	// By default the service replaces tasks within its maximumPercent headroom, at least one at a time
+	maxPercent := int32(200)
+	if svc.DeploymentConfiguration != nil && svc.DeploymentConfiguration.MaximumPercent != nil {
+		maxPercent = *svc.DeploymentConfiguration.MaximumPercent
+	}
+
+	for len(tasks) > 0 {
+		svc, err := describeService(ctx, client, opts.Cluster, service)
+		if err != nil {
+			return err
+		}
+
+		var batch int
+		if opts.MinHealthy < 0 {
+			headroom := int((svc.DesiredCount*maxPercent+99)/100 - svc.RunningCount)
+			batch = min(opts.MaxParallel, max(headroom, 1), len(tasks))
+			fmt.Printf("Service %s: stopping %d of %d remaining tasks (running %d, maximumPercent %d%%)\n", service, batch, len(tasks), svc.RunningCount, maxPercent)
+		} else {
+			batch = min(opts.MaxParallel, int(svc.RunningCount)-opts.MinHealthy, len(tasks))
+			if batch < 1 {
+				return fmt.Errorf("service %s has %d running tasks and needs %d healthy, lower --min-healthy to stop more", service, svc.RunningCount, opts.MinHealthy)
+			}
+			fmt.Printf("Service %s: stopping %d of %d remaining tasks (running %d, keeping at least %d)\n", service, batch, len(tasks), svc.RunningCount, opts.MinHealthy)
+		}
+
+		if err := stopTaskBatch(ctx, client, elb, opts.Cluster, svc, tasks[:batch], batch, opts.Timeout); err != nil {
+			return err
+		}
+		tasks = tasks[batch:]
+
+		if len(tasks) > 0 {
+			if err := waitServiceRunning(ctx, client, opts.Cluster, service, opts.Timeout); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// stopTaskBatch deregisters the tasks from the service target groups, waits for draining and stops them
+func stopTaskBatch(ctx context.Context, client *awsecs.Client, elb *elasticloadbalancingv2.Client, cluster string, svc *ectypes.Service, tasks []ectypes.Task, parallel int, timeout time.Duration) error {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	sem := make(chan struct{}, parallel)
+
+	for _, task := range tasks {
+		wg.Add(1)
+		go func(task ectypes.Task) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			taskID := NameArn(aws.ToString(task.TaskArn))
+			err := func() error {
+				if svc != nil {
+					if err := drainTask(ctx, client, elb, cluster, svc, task, timeout); err != nil {
+						return err
+					}
+				}
+
+				_, err := client.StopTask(ctx, &awsecs.StopTaskInput{
+					Cluster: aws.String(cluster),
+					Task:    task.TaskArn,
+					Reason:  aws.String("Stopped by nami"),
+				})
+				if err != nil {
+					return fmt.Errorf("stop task: %w", err)
+				}
+
+				return awsecs.NewTasksStoppedWaiter(client).Wait(ctx, &awsecs.DescribeTasksInput{
+					Cluster: aws.String(cluster),
+					Tasks:   []string{aws.ToString(task.TaskArn)},
+				}, timeout)
+			}()
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("task %s: %w", taskID, err))
+				return
+			}
+			fmt.Printf("Task %s stopped\n", taskID)
+		}(task)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// drainTask deregisters the task from every target group of the service and waits for connection draining
+func drainTask(ctx context.Context, client *awsecs.Client, elb *elasticloadbalancingv2.Client, cluster string, svc *ectypes.Service, task ectypes.Task, timeout time.Duration) error {
+	instances, err := containerInstanceIDs(ctx, client, cluster, []ectypes.Task{task})
+	if err != nil {
+		return err
+	}
+
+	for _, lb := range svc.LoadBalancers {
+		if lb.TargetGroupArn == nil {
+			continue
+		}
+
+		target := taskTarget(task, aws.ToString(lb.ContainerName), aws.ToInt32(lb.ContainerPort), instances)
+		if target == nil {
+			continue
+		}
+
+		_, err = elb.DeregisterTargets(ctx, &elasticloadbalancingv2.DeregisterTargetsInput{
+			TargetGroupArn: lb.TargetGroupArn,
+			Targets:        []elbtypes.TargetDescription{*target},
+		})
+		if err != nil {
+			return fmt.Errorf("deregister target: %w", err)
+		}
+		fmt.Printf("Task %s deregistered from %s, draining\n", NameArn(aws.ToString(task.TaskArn)), extractTargetGroupID(aws.ToString(lb.TargetGroupArn)))
+
+		err = elasticloadbalancingv2.NewTargetDeregisteredWaiter(elb).Wait(ctx, &elasticloadbalancingv2.DescribeTargetHealthInput{
+			TargetGroupArn: lb.TargetGroupArn,
+			Targets:        []elbtypes.TargetDescription{*target},
+		}, timeout)
+		if err != nil {
+			return fmt.Errorf("waiting for target to drain: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// taskTarget returns the target group target of a task container port: its IP for awsvpc tasks,
+// its EC2 instance, looked up in instances by container instance ARN, and host port otherwise
+func taskTarget(task ectypes.Task, container string, port int32, instances map[string]string) *elbtypes.TargetDescription {
+	for _, c := range task.Containers {
+		if aws.ToString(c.Name) != container {
+			continue
+		}
+
+		if len(c.NetworkInterfaces) > 0 {
+			return &elbtypes.TargetDescription{Id: c.NetworkInterfaces[0].PrivateIpv4Address, Port: aws.Int32(port)}
+		}
+
+		for _, binding := range c.NetworkBindings {
+			if aws.ToInt32(binding.ContainerPort) != port {
+				continue
+			}
+
+			ec2ID, ok := instances[aws.ToString(task.ContainerInstanceArn)]
+			if !ok {
+				return nil
+			}
+			return &elbtypes.TargetDescription{Id: aws.String(ec2ID), Port: binding.HostPort}
+		}
+	}
+
+	return nil
+}
+
+// containerInstanceIDs maps the container instances the tasks run on to their EC2 instance IDs
+func containerInstanceIDs(ctx context.Context, client *awsecs.Client, cluster string, tasks []ectypes.Task) (map[string]string, error) {
+	var arns []string
+	seen := make(map[string]bool)
+	for _, task := range tasks {
+		arn := aws.ToString(task.ContainerInstanceArn)
+		if arn != "" && !seen[arn] {
+			arns = append(arns, arn)
+			seen[arn] = true
+		}
+	}
+
+	instances := make(map[string]string)
+	for start := 0; start < len(arns); start += 100 {
+		end := min(start+100, len(arns))
+		out, err := client.DescribeContainerInstances(ctx, &awsecs.DescribeContainerInstancesInput{
+			Cluster:            aws.String(cluster),
+			ContainerInstances: arns[start:end],
+		})
+		if err != nil {
+			return nil, fmt.Errorf("describe container instances: %w", err)
+		}
+		for _, ci := range out.ContainerInstances {
+			instances[aws.ToString(ci.ContainerInstanceArn)] = aws.ToString(ci.Ec2InstanceId)
+		}
+	}
+
+	return instances, nil
+}
+
+// waitServiceRunning waits until the service runs its desired count again
+func waitServiceRunning(ctx context.Context, client *awsecs.Client, cluster, service string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		svc, err := describeService(ctx, client, cluster, service)
+		if err != nil {
+			return err
+		}
+		if svc.RunningCount >= svc.DesiredCount && svc.PendingCount == 0 {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out after %s waiting for %s to replace stopped tasks (%d/%d running)", timeout, service, svc.RunningCount, svc.DesiredCount)
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
+
+func describeService(ctx context.Context, client *awsecs.Client, cluster, service string) (*ectypes.Service, error) {
+	out, err := client.DescribeServices(ctx, &awsecs.DescribeServicesInput{
+		Cluster:  aws.String(cluster),
+		Services: []string{service},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("describe service: %w", err)
+	}
+	if len(out.Services) == 0 {
+		return nil, fmt.Errorf("service %q not found in cluster %q", service, cluster)
+	}
+
+	return &out.Services[0], nil
+}
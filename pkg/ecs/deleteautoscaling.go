@@ -0,0 +1,191 @@
+package ecs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/applicationautoscaling"
+	"github.com/aws/aws-sdk-go-v2/service/applicationautoscaling/types"
+	"github.com/spf13/cobra"
+)
+
+// policyNames maps the --policy shorthands to the policy names created by `nami set autoscale`
+var policyNames = map[string]string{
+	"cpu":     cpuPolicyName,
+	"mem":     memPolicyName,
+	"memory":  memPolicyName,
+	"request": requestPolicyName,
+	"custom":  customPolicyName,
+}
+
+// DeleteAutoscaling returns the `nami delete autoscale` command
+func DeleteAutoscaling() *cobra.Command {
+	var cluster string
+	var policy string
+
+	cmd := &cobra.Command{
+		Use:     "autoscale [service]",
+		Aliases: []string{"as", "autoscaling"},
+		Short:   "Delete autoscaling policies or the whole scalable target",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			service := args[0]
+
+			if policy == "" {
+				if err := deregisterScalableTarget(cmd.Context(), cluster, service); err != nil {
+					return err
+				}
+				fmt.Printf("Autoscaling removed from %s\n", service)
+				return nil
+			}
+
+			name := policy
+			if mapped, ok := policyNames[strings.ToLower(policy)]; ok {
+				name = mapped
+			}
+
+			if err := deleteScalingPolicy(cmd.Context(), cluster, service, name); err != nil {
+				return err
+			}
+			fmt.Printf("Policy %s deleted from %s\n", name, service)
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVarP(&cluster, "cluster", "c", "", "ECS Cluster name")
+	cmd.MarkFlagRequired("cluster")
+	cmd.Flags().StringVar(&policy, "policy", "", "Only delete this policy (cpu, mem, request, custom or a policy name)")
+
+	return cmd
+}
+
+// SuspendAutoscaling returns the `nami autoscale suspend` command
+func SuspendAutoscaling() *cobra.Command {
+	return suspendCommand("suspend", "Suspend dynamic and scheduled scaling", true)
+}
+
+// ResumeAutoscaling returns the `nami autoscale resume` command
+func ResumeAutoscaling() *cobra.Command {
+	return suspendCommand("resume", "Resume dynamic and scheduled scaling", false)
+}
+
+func suspendCommand(use, short string, suspended bool) *cobra.Command {
+	var cluster string
+
+	cmd := &cobra.Command{
+		Use:   use + " [service]",
+		Short: short,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			service := args[0]
+			if err := setSuspendedState(cmd.Context(), cluster, service, suspended); err != nil {
+				return err
+			}
+
+			if suspended {
+				fmt.Printf("Autoscaling suspended for %s\n", service)
+			} else {
+				fmt.Printf("Autoscaling resumed for %s\n", service)
+			}
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVarP(&cluster, "cluster", "c", "", "ECS Cluster name")
+	cmd.MarkFlagRequired("cluster")
+
+	return cmd
+}
+
+func deregisterScalableTarget(ctx context.Context, cluster, service string) error {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("loading AWS config: %w", err)
+	}
+
+	// Deregistering the target also deletes its scaling policies and scheduled actions
+	_, err = applicationautoscaling.NewFromConfig(cfg).DeregisterScalableTarget(ctx, &applicationautoscaling.DeregisterScalableTargetInput{
+		ServiceNamespace:  types.ServiceNamespaceEcs,
+		ScalableDimension: types.ScalableDimensionECSServiceDesiredCount,
+		ResourceId:        aws.String(fmt.Sprintf("service/%s/%s", cluster, service)),
+	})
+	if err != nil {
+		return fmt.Errorf("deregister scalable target: %w", err)
+	}
+
+	return nil
+}
+
+func deleteScalingPolicy(ctx context.Context, cluster, service, policy string) error {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("loading AWS config: %w", err)
+	}
+
+	_, err = applicationautoscaling.NewFromConfig(cfg).DeleteScalingPolicy(ctx, &applicationautoscaling.DeleteScalingPolicyInput{
+		ServiceNamespace:  types.ServiceNamespaceEcs,
+		ScalableDimension: types.ScalableDimensionECSServiceDesiredCount,
+		ResourceId:        aws.String(fmt.Sprintf("service/%s/%s", cluster, service)),
+		PolicyName:        aws.String(policy),
+	})
+	if err != nil {
+		return fmt.Errorf("delete scaling policy %q: %w", policy, err)
+	}
+
+	return nil
+}
+
+// setSuspendedState re-registers the scalable target without touching min/max, only its SuspendedState
+func setSuspendedState(ctx context.Context, cluster, service string, suspended bool) error {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("loading AWS config: %w", err)
+	}
+
+	_, err = applicationautoscaling.NewFromConfig(cfg).RegisterScalableTarget(ctx, &applicationautoscaling.RegisterScalableTargetInput{
+		ServiceNamespace:  types.ServiceNamespaceEcs,
+		ScalableDimension: types.ScalableDimensionECSServiceDesiredCount,
+		ResourceId:        aws.String(fmt.Sprintf("service/%s/%s", cluster, service)),
+		SuspendedState: &types.SuspendedState{
+			DynamicScalingInSuspended:  aws.Bool(suspended),
+			DynamicScalingOutSuspended: aws.Bool(suspended),
+			ScheduledScalingSuspended:  aws.Bool(suspended),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("update scalable target: %w", err)
+	}
+
+	return nil
+}
+
+// suspendedState summarizes a scalable target's SuspendedState for display
+func suspendedState(state *types.SuspendedState) string {
+	if state == nil {
+		return "NO"
+	}
+
+	var suspended []string
+	if aws.ToBool(state.DynamicScalingInSuspended) {
+		suspended = append(suspended, "IN")
+	}
+	if aws.ToBool(state.DynamicScalingOutSuspended) {
+		suspended = append(suspended, "OUT")
+	}
+	if aws.ToBool(state.ScheduledScalingSuspended) {
+		suspended = append(suspended, "SCHEDULED")
+	}
+
+	switch len(suspended) {
+	case 0:
+		return "NO"
+	case 3:
+		return "YES"
+	}
+	return strings.Join(suspended, ",")
+}
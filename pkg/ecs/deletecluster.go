@@ -1,44 +1,284 @@
 package ecs
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsecs "github.com/aws/aws-sdk-go-v2/service/ecs"
+	ectypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/chnacib/nami/pkg/config"
+	"github.com/chnacib/nami/pkg/utils"
 	"github.com/spf13/cobra"
 )
 
+// ClusterResources is what keeps a cluster from being deleted
+type ClusterResources struct {
+	Services        []ectypes.Service
+	ServiceTasks    []string
+	StandaloneTasks []ectypes.Task
+	Instances       []string
+}
+
+func (r *ClusterResources) empty() bool {
+	return len(r.Services) == 0 && len(r.ServiceTasks) == 0 && len(r.StandaloneTasks) == 0 && len(r.Instances) == 0
+}
+
 func DeleteCluster() *cobra.Command {
-	var cluster string
+	var (
+		cascade    bool
+		yes        bool
+		timeoutSec int
+	)
+
 	cmd := &cobra.Command{
-		Use:     "cluster",
+		Use:     "cluster [name]",
 		Aliases: []string{"clusters"},
 		Short:   "Delete ECS Cluster",
-		Run: func(cmd *cobra.Command, args []string) {
-			cluster = args[0]
-			sess := session.Must(session.NewSessionWithOptions(session.Options{
-				SharedConfigState: session.SharedConfigEnable,
-			}))
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cluster := args[0]
+			ctx := cmd.Context()
 
-			client := ecs.New(sess)
-
-			input := &ecs.DeleteClusterInput{
-				Cluster: aws.String(cluster),
+			cfg, err := config.LoadConfig()
+			if err != nil {
+				return fmt.Errorf("failed to load configuration: %w", err)
 			}
 
-			_, err := client.DeleteCluster(input)
+			client := awsecs.NewFromConfig(cfg.AwsConfig)
 
+			out, err := client.DescribeClusters(ctx, &awsecs.DescribeClustersInput{Clusters: []string{cluster}})
 			if err != nil {
-				fmt.Println(err)
-				os.Exit(0)
+				return fmt.Errorf("describe cluster: %w", err)
+			}
+			if len(out.Clusters) == 0 || aws.ToString(out.Clusters[0].Status) == "INACTIVE" {
+				return fmt.Errorf("cluster %q not found", cluster)
 			}
 
-			fmt.Printf("Cluster %s deleted\n", cluster)
+			resources, err := getClusterResources(ctx, client, cluster)
+			if err != nil {
+				return err
+			}
+
+			printClusterResources(cluster, resources)
+
+			if !resources.empty() && !cascade {
+				return fmt.Errorf("cluster %s is not empty, delete its resources first or use --cascade", cluster)
+			}
+
+			if !yes && !utils.Confirm("Type the cluster name to delete it: ", cluster) {
+				return errors.New("confirmation did not match, cluster not deleted")
+			}
 
+			if !resources.empty() {
+				if err := cascadeDeleteCluster(ctx, client, cluster, resources, time.Duration(timeoutSec)*time.Second); err != nil {
+					return err
+				}
+			}
+
+			if _, err := client.DeleteCluster(ctx, &awsecs.DeleteClusterInput{Cluster: aws.String(cluster)}); err != nil {
+				return fmt.Errorf("delete cluster: %w", err)
+			}
+
+			fmt.Printf("Cluster %s deleted\n", cluster)
+			return nil
 		},
+		SilenceUsage: true,
 	}
 
+	cmd.Flags().BoolVar(&cascade, "cascade", false, "Delete services, stop tasks and deregister instances before deleting the cluster")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Skip the confirmation prompt")
+	cmd.Flags().IntVar(&timeoutSec, "timeout", 600, "Seconds to wait for services and tasks to stop with --cascade")
+
 	return cmd
 }
+
+// getClusterResources lists the services, running tasks and container instances of the cluster
+func getClusterResources(ctx context.Context, client *awsecs.Client, cluster string) (*ClusterResources, error) {
+	resources := &ClusterResources{}
+
+	var serviceArns []string
+	services := awsecs.NewListServicesPaginator(client, &awsecs.ListServicesInput{Cluster: aws.String(cluster)})
+	for services.HasMorePages() {
+		page, err := services.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("list services: %w", err)
+		}
+		serviceArns = append(serviceArns, page.ServiceArns...)
+	}
+	for start := 0; start < len(serviceArns); start += 10 {
+		end := min(start+10, len(serviceArns))
+		out, err := client.DescribeServices(ctx, &awsecs.DescribeServicesInput{
+			Cluster:  aws.String(cluster),
+			Services: serviceArns[start:end],
+		})
+		if err != nil {
+			return nil, fmt.Errorf("describe services: %w", err)
+		}
+		resources.Services = append(resources.Services, out.Services...)
+	}
+
+	var taskArns []string
+	tasks := awsecs.NewListTasksPaginator(client, &awsecs.ListTasksInput{Cluster: aws.String(cluster)})
+	for tasks.HasMorePages() {
+		page, err := tasks.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("list tasks: %w", err)
+		}
+		taskArns = append(taskArns, page.TaskArns...)
+	}
+	for start := 0; start < len(taskArns); start += 100 {
+		end := min(start+100, len(taskArns))
+		out, err := client.DescribeTasks(ctx, &awsecs.DescribeTasksInput{
+			Cluster: aws.String(cluster),
+			Tasks:   taskArns[start:end],
+		})
+		if err != nil {
+			return nil, fmt.Errorf("describe tasks: %w", err)
+		}
+		for _, task := range out.Tasks {
+			if strings.HasPrefix(aws.ToString(task.Group), "service:") {
+				resources.ServiceTasks = append(resources.ServiceTasks, aws.ToString(task.TaskArn))
+			} else {
+				resources.StandaloneTasks = append(resources.StandaloneTasks, task)
+			}
+		}
+	}
+
+	instances := awsecs.NewListContainerInstancesPaginator(client, &awsecs.ListContainerInstancesInput{Cluster: aws.String(cluster)})
+	for instances.HasMorePages() {
+		page, err := instances.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("list container instances: %w", err)
+		}
+		resources.Instances = append(resources.Instances, page.ContainerInstanceArns...)
+	}
+
+	return resources, nil
+}
+
+func printClusterResources(cluster string, r *ClusterResources) {
+	if r.empty() {
+		fmt.Printf("Cluster %s has no services, tasks or container instances\n\n", cluster)
+		return
+	}
+
+	fmt.Printf("Cluster %s contains %d services, %d running tasks (%d standalone) and %d container instances\n\n",
+		cluster, len(r.Services), len(r.ServiceTasks)+len(r.StandaloneTasks), len(r.StandaloneTasks), len(r.Instances))
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	if len(r.Services) > 0 {
+		fmt.Fprintln(w, "SERVICE\tSTATUS\tRUNNING\tDESIRED")
+		for _, svc := range r.Services {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\n", aws.ToString(svc.ServiceName), aws.ToString(svc.Status), svc.RunningCount, svc.DesiredCount)
+		}
+		fmt.Fprintln(w)
+	}
+	if len(r.StandaloneTasks) > 0 {
+		fmt.Fprintln(w, "STANDALONE TASK\tSTATUS\tTASK DEFINITION\tSTARTED BY")
+		for _, task := range r.StandaloneTasks {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", NameArn(aws.ToString(task.TaskArn)), aws.ToString(task.LastStatus),
+				NameArn(aws.ToString(task.TaskDefinitionArn)), aws.ToString(task.StartedBy))
+		}
+		fmt.Fprintln(w)
+	}
+	w.Flush()
+}
+
+// cascadeDeleteCluster removes everything that keeps the cluster from being deleted
+func cascadeDeleteCluster(ctx context.Context, client *awsecs.Client, cluster string, r *ClusterResources, timeout time.Duration) error {
+	for i, svc := range r.Services {
+		name := aws.ToString(svc.ServiceName)
+
+		if aws.ToString(svc.Status) == "ACTIVE" {
+			// Daemon services cannot be scaled, the forced delete stops their tasks
+			if svc.DesiredCount > 0 && svc.SchedulingStrategy != ectypes.SchedulingStrategyDaemon {
+				_, err := client.UpdateService(ctx, &awsecs.UpdateServiceInput{
+					Cluster:      aws.String(cluster),
+					Service:      aws.String(name),
+					DesiredCount: aws.Int32(0),
+				})
+				if err != nil {
+					return fmt.Errorf("scale service %s to 0: %w", name, err)
+				}
+			}
+
+			_, err := client.DeleteService(ctx, &awsecs.DeleteServiceInput{
+				Cluster: aws.String(cluster),
+				Service: aws.String(name),
+				Force:   aws.Bool(true),
+			})
+			if err != nil {
+				return fmt.Errorf("delete service %s: %w", name, err)
+			}
+		}
+
+		if svc.SchedulingStrategy == ectypes.SchedulingStrategyDaemon {
+			fmt.Printf("[%d/%d] Daemon service %s deleted\n", i+1, len(r.Services), name)
+		} else {
+			fmt.Printf("[%d/%d] Service %s scaled to 0 and deleted\n", i+1, len(r.Services), name)
+		}
+	}
+
+	if len(r.Services) > 0 {
+		fmt.Println("Waiting for services to become INACTIVE...")
+		waiter := awsecs.NewServicesInactiveWaiter(client)
+		for start := 0; start < len(r.Services); start += 10 {
+			end := min(start+10, len(r.Services))
+
+			var names []string
+			for _, svc := range r.Services[start:end] {
+				names = append(names, aws.ToString(svc.ServiceArn))
+			}
+			if err := waiter.Wait(ctx, &awsecs.DescribeServicesInput{Cluster: aws.String(cluster), Services: names}, timeout); err != nil {
+				return fmt.Errorf("waiting for services to become inactive: %w", err)
+			}
+		}
+	}
+
+	for i, task := range r.StandaloneTasks {
+		_, err := client.StopTask(ctx, &awsecs.StopTaskInput{
+			Cluster: aws.String(cluster),
+			Task:    task.TaskArn,
+			Reason:  aws.String("Cluster deleted by nami"),
+		})
+		if err != nil {
+			return fmt.Errorf("stop task %s: %w", NameArn(aws.ToString(task.TaskArn)), err)
+		}
+		fmt.Printf("[%d/%d] Task %s stopped\n", i+1, len(r.StandaloneTasks), NameArn(aws.ToString(task.TaskArn)))
+	}
+
+	taskArns := append([]string(nil), r.ServiceTasks...)
+	for _, task := range r.StandaloneTasks {
+		taskArns = append(taskArns, aws.ToString(task.TaskArn))
+	}
+	if len(taskArns) > 0 {
+		fmt.Printf("Waiting for %d tasks to stop...\n", len(taskArns))
+		waiter := awsecs.NewTasksStoppedWaiter(client)
+		for start := 0; start < len(taskArns); start += 100 {
+			end := min(start+100, len(taskArns))
+			if err := waiter.Wait(ctx, &awsecs.DescribeTasksInput{Cluster: aws.String(cluster), Tasks: taskArns[start:end]}, timeout); err != nil {
+				return fmt.Errorf("waiting for tasks to stop: %w", err)
+			}
+		}
+	}
+
+	for i, instance := range r.Instances {
+		_, err := client.DeregisterContainerInstance(ctx, &awsecs.DeregisterContainerInstanceInput{
+			Cluster:           aws.String(cluster),
+			ContainerInstance: aws.String(instance),
+			Force:             aws.Bool(true),
+		})
+		if err != nil {
+			return fmt.Errorf("deregister container instance %s: %w", NameArn(instance), err)
+		}
+		fmt.Printf("[%d/%d] Container instance %s deregistered\n", i+1, len(r.Instances), NameArn(instance))
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package ecs
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	awsecs "github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/chnacib/nami/pkg/config"
+	"github.com/chnacib/nami/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+// DeleteNode returns the `nami delete node` command
+func DeleteNode() *cobra.Command {
+	var (
+		cluster   string
+		terminate bool
+		force     bool
+		yes       bool
+	)
+
+	cmd := &cobra.Command{
+		Use:     "node [id]",
+		Aliases: []string{"nodes"},
+		Short:   "Deregister a container instance and optionally terminate its EC2 instance",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			cfg, err := config.LoadConfig()
+			if err != nil {
+				return fmt.Errorf("failed to load configuration: %w", err)
+			}
+
+			client := awsecs.NewFromConfig(cfg.AwsConfig)
+
+			instance, err := resolveNode(ctx, client, cluster, args[0])
+			if err != nil {
+				return err
+			}
+			id := NameArn(aws.ToString(instance.ContainerInstanceArn))
+			ec2ID := aws.ToString(instance.Ec2InstanceId)
+
+			tasks := instance.RunningTasksCount + instance.PendingTasksCount
+			if tasks > 0 && !force {
+				return fmt.Errorf("node %s has %d tasks, drain it first (nami drain node %s -c %s) or use --force", id, tasks, id, cluster)
+			}
+
+			prompt := fmt.Sprintf("Deregister node %s (%s) from %s? [y/N] ", id, ec2ID, cluster)
+			if terminate {
+				prompt = fmt.Sprintf("Deregister node %s from %s and terminate %s? [y/N] ", id, cluster, ec2ID)
+			}
+			if !yes && !utils.Confirm(prompt, "y") {
+				return errors.New("node not deleted")
+			}
+
+			_, err = client.DeregisterContainerInstance(ctx, &awsecs.DeregisterContainerInstanceInput{
+				Cluster:           aws.String(cluster),
+				ContainerInstance: instance.ContainerInstanceArn,
+				Force:             aws.Bool(force),
+			})
+			if err != nil {
+				return fmt.Errorf("deregister container instance: %w", err)
+			}
+			fmt.Printf("Node %s deregistered\n", id)
+
+			if !terminate {
+				return nil
+			}
+
+			_, err = ec2.NewFromConfig(cfg.AwsConfig).TerminateInstances(ctx, &ec2.TerminateInstancesInput{
+				InstanceIds: []string{ec2ID},
+			})
+			if err != nil {
+				return fmt.Errorf("terminate instance %s: %w", ec2ID, err)
+			}
+			fmt.Printf("EC2 instance %s terminating\n", ec2ID)
+
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVarP(&cluster, "cluster", "c", "", "ECS Cluster name")
+	cmd.MarkFlagRequired("cluster")
+	cmd.Flags().BoolVar(&terminate, "terminate", false, "Also terminate the EC2 instance")
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "Deregister even if tasks are still running on the node")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Skip the confirmation prompt")
+
+	return cmd
+}
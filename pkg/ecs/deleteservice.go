@@ -1,51 +1,276 @@
 package ecs
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/applicationautoscaling"
+	astypes "github.com/aws/aws-sdk-go-v2/service/applicationautoscaling/types"
+	awsecs "github.com/aws/aws-sdk-go-v2/service/ecs"
+	ectypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
+	elbtypes "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2/types"
+	"github.com/chnacib/nami/pkg/config"
+	"github.com/chnacib/nami/pkg/utils"
 	"github.com/spf13/cobra"
 )
 
+type DeleteServiceOptions struct {
+	Cluster         string
+	Service         string
+	Force           bool // delete right away without scaling to 0 and draining
+	Wait            bool // wait for the service to become INACTIVE
+	KeepAutoscaling bool
+	Timeout         time.Duration
+}
+
 func DeleteService() *cobra.Command {
-	var cluster string
-	var service string
-	var force bool = false
+	var (
+		opts       DeleteServiceOptions
+		yes        bool
+		timeoutSec int
+	)
+
 	cmd := &cobra.Command{
-		Use:     "service",
+		Use:     "service [name]",
 		Aliases: []string{"svc", "services"},
-		Short:   "Delete ECS service",
-		Run: func(cmd *cobra.Command, args []string) {
-			service = args[0]
-			sess := session.Must(session.NewSessionWithOptions(session.Options{
-				SharedConfigState: session.SharedConfigEnable,
-			}))
+		Short:   "Drain and delete ECS service",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.Service = args[0]
+			opts.Timeout = time.Duration(timeoutSec) * time.Second
 
-			client := ecs.New(sess)
+			if !yes && !utils.Confirm(fmt.Sprintf("Delete service %s in cluster %s? [y/N] ", opts.Service, opts.Cluster), "y") {
+				return errors.New("service not deleted")
+			}
 
-			input := &ecs.DeleteServiceInput{
-				Service: aws.String(service),
-				Cluster: aws.String(cluster),
-				Force:   aws.Bool(force),
+			if err := deleteService(cmd.Context(), opts); err != nil {
+				return err
 			}
 
-			_, err := client.DeleteService(input)
+			fmt.Printf("Service %s deleted\n", opts.Service)
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVarP(&opts.Cluster, "cluster", "c", "", "ECS Cluster name")
+	cmd.MarkFlagRequired("cluster")
+	cmd.Flags().BoolVarP(&opts.Force, "force", "f", false, "Delete immediately without scaling to 0 and draining")
+	cmd.Flags().BoolVar(&opts.Wait, "wait", false, "Wait until the service is INACTIVE")
+	cmd.Flags().BoolVar(&opts.KeepAutoscaling, "keep-autoscaling", true, "Keep the scalable target registered and resume it after deletion (false deregisters it with its policies)")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Skip the confirmation prompt")
+	cmd.Flags().IntVar(&timeoutSec, "timeout", 900, "Seconds to wait for draining and --wait")
 
+	return cmd
+}
+
+// deleteService scales the service to 0, waits for its targets to drain and its tasks to stop, then deletes it
+func deleteService(ctx context.Context, opts DeleteServiceOptions) error {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	client := awsecs.NewFromConfig(cfg.AwsConfig)
+	resourceID := fmt.Sprintf("service/%s/%s", opts.Cluster, opts.Service)
+
+	out, err := client.DescribeServices(ctx, &awsecs.DescribeServicesInput{
+		Cluster:  aws.String(opts.Cluster),
+		Services: []string{opts.Service},
+	})
+	if err != nil {
+		return fmt.Errorf("describe service: %w", err)
+	}
+	if len(out.Services) == 0 || aws.ToString(out.Services[0].Status) == "INACTIVE" {
+		return fmt.Errorf("service %q not found in cluster %q", opts.Service, opts.Cluster)
+	}
+	svc := out.Services[0]
+
+	targets, err := applicationautoscaling.NewFromConfig(cfg.AwsConfig).DescribeScalableTargets(ctx, &applicationautoscaling.DescribeScalableTargetsInput{
+		ServiceNamespace:  astypes.ServiceNamespaceEcs,
+		ScalableDimension: astypes.ScalableDimensionECSServiceDesiredCount,
+		ResourceIds:       []string{resourceID},
+	})
+	if err != nil {
+		return fmt.Errorf("describe scalable target: %w", err)
+	}
+	if len(targets.ScalableTargets) > 0 {
+		if opts.KeepAutoscaling {
+			// Keep autoscaling from scaling the service back up while it drains, and leave the kept
+			// scalable target active again for a service recreated with the same name
+			if err := setSuspendedState(ctx, opts.Cluster, opts.Service, true); err != nil {
+				return err
+			}
+			fmt.Println("Autoscaling suspended")
+			defer func() {
+				if err := setSuspendedState(ctx, opts.Cluster, opts.Service, false); err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: resume autoscaling: %v\n", err)
+					return
+				}
+				fmt.Println("Autoscaling resumed")
+			}()
+		} else {
+			if err := deregisterScalableTarget(ctx, opts.Cluster, opts.Service); err != nil {
+				return err
+			}
+			fmt.Println("Scalable target deregistered")
+		}
+	}
+
+	// Daemon services cannot be scaled to 0, deleting them stops their tasks and they are drained after
+	daemon := svc.SchedulingStrategy == ectypes.SchedulingStrategyDaemon
+	drain := !opts.Force && aws.ToString(svc.Status) == "ACTIVE"
+
+	// The targets of the service's tasks, looked up before the service is deleted, other services can
+	// share the target groups
+	var ownTargets map[string]bool
+	if drain {
+		ownTargets, err = serviceTargetKeys(ctx, client, opts.Cluster, svc)
+		if err != nil {
+			return err
+		}
+	}
+
+	if drain && !daemon {
+		if svc.DesiredCount > 0 {
+			_, err := client.UpdateService(ctx, &awsecs.UpdateServiceInput{
+				Cluster:      aws.String(opts.Cluster),
+				Service:      aws.String(opts.Service),
+				DesiredCount: aws.Int32(0),
+			})
 			if err != nil {
-				fmt.Println(err)
-				os.Exit(0)
+				return fmt.Errorf("scale service to 0: %w", err)
 			}
+			fmt.Printf("Service %s scaled to 0\n", opts.Service)
+		}
 
-			fmt.Printf("Service %s deleted\n", service)
+		if err := waitServiceDrained(ctx, client, elasticloadbalancingv2.NewFromConfig(cfg.AwsConfig), opts.Cluster, svc, ownTargets, opts.Timeout); err != nil {
+			return err
+		}
+	}
 
-		},
+	_, err = client.DeleteService(ctx, &awsecs.DeleteServiceInput{
+		Cluster: aws.String(opts.Cluster),
+		Service: aws.String(opts.Service),
+		Force:   aws.Bool(opts.Force || daemon),
+	})
+	if err != nil {
+		return fmt.Errorf("delete service: %w", err)
 	}
-	cmd.Flags().StringVarP(&cluster, "cluster", "c", "string", "ECS task name")
-	cmd.MarkFlagRequired("cluster")
-	cmd.Flags().BoolVarP(&force, "force", "f", true, "Force delete service")
 
-	return cmd
+	if drain && daemon {
+		if err := waitServiceDrained(ctx, client, elasticloadbalancingv2.NewFromConfig(cfg.AwsConfig), opts.Cluster, svc, ownTargets, opts.Timeout); err != nil {
+			return err
+		}
+	}
+
+	if !opts.Wait {
+		return nil
+	}
+
+	fmt.Printf("Waiting for %s to become INACTIVE...\n", opts.Service)
+	err = awsecs.NewServicesInactiveWaiter(client).Wait(ctx, &awsecs.DescribeServicesInput{
+		Cluster:  aws.String(opts.Cluster),
+		Services: []string{opts.Service},
+	}, opts.Timeout)
+	if err != nil {
+		return fmt.Errorf("waiting for service to become inactive: %w", err)
+	}
+
+	return nil
+}
+
+// waitServiceDrained polls until the service has no tasks left and none of its targets, as returned by
+// serviceTargetKeys, is draining
+func waitServiceDrained(ctx context.Context, client *awsecs.Client, elb *elasticloadbalancingv2.Client, cluster string, svc ectypes.Service, targets map[string]bool, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	last := ""
+
+	for {
+		out, err := client.DescribeServices(ctx, &awsecs.DescribeServicesInput{
+			Cluster:  aws.String(cluster),
+			Services: []string{aws.ToString(svc.ServiceName)},
+		})
+		if err != nil {
+			return fmt.Errorf("describe service: %w", err)
+		}
+		if len(out.Services) == 0 {
+			return nil
+		}
+		tasks := out.Services[0].RunningCount + out.Services[0].PendingCount
+
+		draining := 0
+		for _, lb := range svc.LoadBalancers {
+			if lb.TargetGroupArn == nil {
+				continue
+			}
+			health, err := elb.DescribeTargetHealth(ctx, &elasticloadbalancingv2.DescribeTargetHealthInput{TargetGroupArn: lb.TargetGroupArn})
+			if err != nil {
+				return fmt.Errorf("describe target health: %w", err)
+			}
+			for _, t := range health.TargetHealthDescriptions {
+				if t.Target == nil || !targets[targetKey(aws.ToString(lb.TargetGroupArn), *t.Target)] {
+					continue
+				}
+				if t.TargetHealth != nil && t.TargetHealth.State == elbtypes.TargetHealthStateEnumDraining {
+					draining++
+				}
+			}
+		}
+
+		status := fmt.Sprintf("%d tasks running, %d targets draining", tasks, draining)
+		if status != last {
+			fmt.Printf("Waiting: %s\n", status)
+			last = status
+		}
+
+		if tasks == 0 && draining == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out after %s waiting for %s to drain (%s)", timeout, aws.ToString(svc.ServiceName), status)
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
+
+// serviceTargetKeys returns the targetKey of every target the service's running and recently stopped tasks
+// registered in its target groups
+func serviceTargetKeys(ctx context.Context, client *awsecs.Client, cluster string, svc ectypes.Service) (map[string]bool, error) {
+	var tasks []ectypes.Task
+	for _, status := range []ectypes.DesiredStatus{ectypes.DesiredStatusRunning, ectypes.DesiredStatusStopped} {
+		found, err := serviceTasks(ctx, client, cluster, aws.ToString(svc.ServiceName), status)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, found...)
+	}
+
+	instances, err := containerInstanceIDs(ctx, client, cluster, tasks)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]bool)
+	for _, lb := range svc.LoadBalancers {
+		if lb.TargetGroupArn == nil {
+			continue
+		}
+		for _, task := range tasks {
+			if target := taskTarget(task, aws.ToString(lb.ContainerName), aws.ToInt32(lb.ContainerPort), instances); target != nil && target.Id != nil {
+				keys[targetKey(aws.ToString(lb.TargetGroupArn), *target)] = true
+			}
+		}
+	}
+
+	return keys, nil
+}
+
+func targetKey(targetGroupArn string, target elbtypes.TargetDescription) string {
+	return fmt.Sprintf("%s %s:%d", targetGroupArn, aws.ToString(target.Id), aws.ToInt32(target.Port))
 }
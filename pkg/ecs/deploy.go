@@ -108,35 +108,11 @@ func deployService(ctx context.Context, opts DeployOptions) (string, error) {
 
 	client := awsecs.NewFromConfig(cfg)
 
-	svcOut, err := client.DescribeServices(ctx, &awsecs.DescribeServicesInput{
-		Cluster:  aws.String(opts.Cluster),
-		Services: []string{opts.Service},
-	})
-	if err != nil {
-		return "", fmt.Errorf("describe service: %w", err)
-	}
-	if len(svcOut.Services) == 0 {
-		return "", fmt.Errorf("service %q not found in cluster %q", opts.Service, opts.Cluster)
-	}
-
-	svc := svcOut.Services[0]
-	if svc.TaskDefinition == nil {
-		return "", fmt.Errorf("service %q has no task definition", opts.Service)
-	}
-
-	currentTDArn := aws.ToString(svc.TaskDefinition)
-
-	tdOut, err := client.DescribeTaskDefinition(ctx, &awsecs.DescribeTaskDefinitionInput{
-		TaskDefinition: aws.String(currentTDArn),
-	})
+	_, td, err := describeServiceTaskDefinition(ctx, client, opts.Cluster, opts.Service)
 	if err != nil {
-		return "", fmt.Errorf("describe task definition %q: %w", currentTDArn, err)
-	}
-
-	td := tdOut.TaskDefinition
-	if td == nil {
-		return "", fmt.Errorf("task definition %q not found", currentTDArn)
+		return "", err
 	}
+	currentTDArn := aws.ToString(td.TaskDefinitionArn)
 
 	containers := make([]ectypes.ContainerDefinition, len(td.ContainerDefinitions))
 	copy(containers, td.ContainerDefinitions)
@@ -161,6 +137,55 @@ func deployService(ctx context.Context, opts DeployOptions) (string, error) {
 		}
 	}
 
+	newTDArn, err := registerTaskDefinitionRevision(ctx, client, td, containers)
+	if err != nil {
+		return "", err
+	}
+
+	if err := rolloutTaskDefinition(ctx, client, opts.Cluster, opts.Service, newTDArn, opts.Wait, opts.Timeout); err != nil {
+		return "", err
+	}
+
+	return newTDArn, nil
+}
+
+// describeServiceTaskDefinition retorna o serviço e a task definition que ele está rodando
+func describeServiceTaskDefinition(ctx context.Context, client *awsecs.Client, cluster, service string) (*ectypes.Service, *ectypes.TaskDefinition, error) {
+	svcOut, err := client.DescribeServices(ctx, &awsecs.DescribeServicesInput{
+		Cluster:  aws.String(cluster),
+		Services: []string{service},
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("describe service: %w", err)
+	}
+	if len(svcOut.Services) == 0 {
+		return nil, nil, fmt.Errorf("service %q not found in cluster %q", service, cluster)
+	}
+
+	svc := svcOut.Services[0]
+	if svc.TaskDefinition == nil {
+		return nil, nil, fmt.Errorf("service %q has no task definition", service)
+	}
+
+	currentTDArn := aws.ToString(svc.TaskDefinition)
+
+	tdOut, err := client.DescribeTaskDefinition(ctx, &awsecs.DescribeTaskDefinitionInput{
+		TaskDefinition: aws.String(currentTDArn),
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("describe task definition %q: %w", currentTDArn, err)
+	}
+
+	td := tdOut.TaskDefinition
+	if td == nil {
+		return nil, nil, fmt.Errorf("task definition %q not found", currentTDArn)
+	}
+
+	return &svc, td, nil
+}
+
+// registerTaskDefinitionRevision registra uma nova revisão clonando td com os containers informados
+func registerTaskDefinitionRevision(ctx context.Context, client *awsecs.Client, td *ectypes.TaskDefinition, containers []ectypes.ContainerDefinition) (string, error) {
 	regIn := &awsecs.RegisterTaskDefinitionInput{
 		Family:                  td.Family,
 		TaskRoleArn:             td.TaskRoleArn,
@@ -188,22 +213,25 @@ func deployService(ctx context.Context, opts DeployOptions) (string, error) {
 		return "", errors.New("register task definition returned empty task definition ARN")
 	}
 
-	newTDArn := aws.ToString(regOut.TaskDefinition.TaskDefinitionArn)
+	return aws.ToString(regOut.TaskDefinition.TaskDefinitionArn), nil
+}
 
-	_, err = client.UpdateService(ctx, &awsecs.UpdateServiceInput{
-		Cluster:        aws.String(opts.Cluster),
-		Service:        aws.String(opts.Service),
-		TaskDefinition: aws.String(newTDArn),
+// rolloutTaskDefinition aponta o serviço para tdArn e, se wait, aguarda o steady state
+func rolloutTaskDefinition(ctx context.Context, client *awsecs.Client, cluster, service, tdArn string, wait bool, timeout time.Duration) error {
+	_, err := client.UpdateService(ctx, &awsecs.UpdateServiceInput{
+		Cluster:        aws.String(cluster),
+		Service:        aws.String(service),
+		TaskDefinition: aws.String(tdArn),
 	})
 	if err != nil {
-		return "", fmt.Errorf("update service to task definition %q: %w", newTDArn, err)
+		return fmt.Errorf("update service to task definition %q: %w", tdArn, err)
 	}
 
-	if !opts.Wait {
-		return newTDArn, nil
+	if !wait {
+		return nil
 	}
 
-	maxWait := opts.Timeout
+	maxWait := timeout
 	if maxWait <= 0 {
 		maxWait = 5 * time.Minute
 	}
@@ -211,11 +239,11 @@ func deployService(ctx context.Context, opts DeployOptions) (string, error) {
 	waiter := awsecs.NewServicesStableWaiter(client)
 
 	if err := waiter.Wait(ctx, &awsecs.DescribeServicesInput{
-		Cluster:  aws.String(opts.Cluster),
-		Services: []string{opts.Service},
+		Cluster:  aws.String(cluster),
+		Services: []string{service},
 	}, maxWait); err != nil {
-		return "", fmt.Errorf("waiting for service to stabilize: %w", err)
+		return fmt.Errorf("waiting for service to stabilize: %w", err)
 	}
 
-	return newTDArn, nil
+	return nil
 }
@@ -0,0 +1,386 @@
+package ecs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsecs "github.com/aws/aws-sdk-go-v2/service/ecs"
+	ectypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/chnacib/nami/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+type NodeTask struct {
+	ID             string
+	Group          string // service:<name> or family:<name>
+	TaskDefinition string
+	CPU            int32
+	Memory         int32
+	Status         string
+}
+
+// TaskSize is the CPU and memory a task definition reserves on a node
+type TaskSize struct {
+	TaskDefinition string
+	CPU            int32
+	Memory         int32
+}
+
+type NodeTasks struct {
+	Node  NodeOutput
+	Tasks []NodeTask
+	NoFit []TaskSize // largest task definitions that no longer fit in the node's remaining resources
+}
+
+// DescribeNode returns the `nami describe node` command
+func DescribeNode() *cobra.Command {
+	var cluster string
+
+	cmd := &cobra.Command{
+		Use:     "node [id]",
+		Aliases: []string{"nodes"},
+		Short:   "Describe an ECS container instance and the tasks placed on it",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			node, err := DescribeNodeTasks(cmd.Context(), cluster, args[0])
+			if err != nil {
+				return err
+			}
+
+			printNodeDetails(node.Node)
+			printNodeTasks(*node)
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVarP(&cluster, "cluster", "c", "", "ECS Cluster name")
+	cmd.MarkFlagRequired("cluster")
+
+	return cmd
+}
+
+// DescribeNodeTasks returns a single node, given its ID, ARN or EC2 instance ID, with the tasks placed on it.
+// The node is flagged when it cannot fit the largest task definitions used in the cluster.
+func DescribeNodeTasks(ctx context.Context, cluster, id string) (*NodeTasks, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	client := awsecs.NewFromConfig(cfg.AwsConfig)
+
+	instance, err := resolveNode(ctx, client, cluster, id)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := []NodeOutput{nodeOutput(*instance)}
+	fillPrivateIPs(ctx, cfg.AwsConfig, nodes)
+
+	tasks, err := clusterTasks(ctx, client, cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &NodeTasks{Node: nodes[0]}
+	for _, task := range tasks {
+		if aws.ToString(task.ContainerInstanceArn) == output.Node.Arn {
+			addNodeTask(output, task)
+		}
+	}
+
+	sizes, err := clusterTaskSizes(ctx, client, cluster, tasks)
+	if err != nil {
+		return nil, err
+	}
+	finishNodeTasks(output, sizes)
+
+	return output, nil
+}
+
+// GetNodeTasks returns the nodes of the cluster with the running tasks placed on each, and flags the nodes
+// that cannot fit the largest task definitions used in the cluster
+func GetNodeTasks(ctx context.Context, cluster string) ([]NodeTasks, error) {
+	nodes, err := GetNodes(ctx, cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	client := awsecs.NewFromConfig(cfg.AwsConfig)
+
+	tasks, err := clusterTasks(ctx, client, cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	output := make([]NodeTasks, len(nodes))
+	index := make(map[string]int)
+	for i, n := range nodes {
+		output[i].Node = n
+		index[n.Arn] = i
+	}
+
+	for _, task := range tasks {
+		if i, ok := index[aws.ToString(task.ContainerInstanceArn)]; ok {
+			addNodeTask(&output[i], task)
+		}
+	}
+
+	sizes, err := clusterTaskSizes(ctx, client, cluster, tasks)
+	if err != nil {
+		return nil, err
+	}
+	for i := range output {
+		finishNodeTasks(&output[i], sizes)
+	}
+
+	return output, nil
+}
+
+// clusterTaskSizes returns the sizes of the task definitions used in the cluster by task definition ARN: those of
+// the tasks running on EC2 and those of the services, which may have no task running right now
+func clusterTaskSizes(ctx context.Context, client *awsecs.Client, cluster string, tasks []ectypes.Task) (map[string]TaskSize, error) {
+	sizes := make(map[string]TaskSize)
+	for _, task := range tasks {
+		if task.ContainerInstanceArn == nil {
+			continue // Fargate task
+		}
+		tdArn := aws.ToString(task.TaskDefinitionArn)
+		cpu, memory := taskReservation(task)
+		sizes[tdArn] = TaskSize{TaskDefinition: NameArn(tdArn), CPU: cpu, Memory: memory}
+	}
+
+	taskDefinitions, err := serviceTaskDefinitions(ctx, client, cluster)
+	if err != nil {
+		return nil, err
+	}
+	for _, td := range taskDefinitions {
+		if _, ok := sizes[td]; ok {
+			continue
+		}
+
+		out, err := client.DescribeTaskDefinition(ctx, &awsecs.DescribeTaskDefinitionInput{TaskDefinition: aws.String(td)})
+		if err != nil {
+			return nil, fmt.Errorf("describe task definition %s: %w", NameArn(td), err)
+		}
+		if !runsOnEC2(out.TaskDefinition) {
+			continue
+		}
+
+		cpu, memory := taskDefinitionReservation(out.TaskDefinition)
+		sizes[td] = TaskSize{TaskDefinition: NameArn(td), CPU: cpu, Memory: memory}
+	}
+
+	return sizes, nil
+}
+
+// serviceTaskDefinitions returns the task definition ARNs used by the services of the cluster, which may be none
+func serviceTaskDefinitions(ctx context.Context, client *awsecs.Client, cluster string) ([]string, error) {
+	var arns []string
+	paginator := awsecs.NewListServicesPaginator(client, &awsecs.ListServicesInput{Cluster: aws.String(cluster)})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("list services: %w", err)
+		}
+		arns = append(arns, page.ServiceArns...)
+	}
+
+	var taskDefinitions []string
+	for start := 0; start < len(arns); start += 10 {
+		end := min(start+10, len(arns))
+		out, err := client.DescribeServices(ctx, &awsecs.DescribeServicesInput{
+			Cluster:  aws.String(cluster),
+			Services: arns[start:end],
+		})
+		if err != nil {
+			return nil, fmt.Errorf("describe services: %w", err)
+		}
+		for _, svc := range out.Services {
+			if svc.TaskDefinition != nil {
+				taskDefinitions = append(taskDefinitions, aws.ToString(svc.TaskDefinition))
+			}
+		}
+	}
+
+	return taskDefinitions, nil
+}
+
+// addNodeTask adds a task to the node
+func addNodeTask(n *NodeTasks, task ectypes.Task) {
+	cpu, memory := taskReservation(task)
+	n.Tasks = append(n.Tasks, NodeTask{
+		ID:             NameArn(aws.ToString(task.TaskArn)),
+		Group:          aws.ToString(task.Group),
+		TaskDefinition: NameArn(aws.ToString(task.TaskDefinitionArn)),
+		CPU:            cpu,
+		Memory:         memory,
+		Status:         aws.ToString(task.LastStatus),
+	})
+}
+
+// finishNodeTasks flags the largest task sizes that no longer fit in the node and sorts its tasks by group
+func finishNodeTasks(n *NodeTasks, sizes map[string]TaskSize) {
+	var largestCPU, largestMemory TaskSize
+	for _, size := range sizes {
+		if size.CPU > largestCPU.CPU {
+			largestCPU = size
+		}
+		if size.Memory > largestMemory.Memory {
+			largestMemory = size
+		}
+	}
+
+	for _, size := range []TaskSize{largestCPU, largestMemory} {
+		if size.TaskDefinition == "" || (size.CPU <= n.Node.RemainingCPU && size.Memory <= n.Node.RemainingMemory) {
+			continue
+		}
+		if len(n.NoFit) > 0 && n.NoFit[0] == size {
+			continue
+		}
+		n.NoFit = append(n.NoFit, size)
+	}
+
+	sort.Slice(n.Tasks, func(a, b int) bool {
+		ta, tb := n.Tasks[a], n.Tasks[b]
+		if ta.Group != tb.Group {
+			return ta.Group < tb.Group
+		}
+		return ta.ID < tb.ID
+	})
+}
+
+// taskReservation returns the CPU units and MiB a running task reserves: the task-level size when set,
+// otherwise the sum of its containers (memory reservation before the hard limit)
+func taskReservation(task ectypes.Task) (int32, int32) {
+	cpu, memory := atoi32(aws.ToString(task.Cpu)), atoi32(aws.ToString(task.Memory))
+
+	var containerCPU, containerMemory int32
+	for _, c := range task.Containers {
+		containerCPU += atoi32(aws.ToString(c.Cpu))
+		if c.MemoryReservation != nil {
+			containerMemory += atoi32(aws.ToString(c.MemoryReservation))
+		} else {
+			containerMemory += atoi32(aws.ToString(c.Memory))
+		}
+	}
+
+	if cpu == 0 {
+		cpu = containerCPU
+	}
+	if memory == 0 {
+		memory = containerMemory
+	}
+	return cpu, memory
+}
+
+// taskDefinitionReservation is taskReservation for a task definition
+func taskDefinitionReservation(td *ectypes.TaskDefinition) (int32, int32) {
+	cpu, memory := atoi32(aws.ToString(td.Cpu)), atoi32(aws.ToString(td.Memory))
+
+	var containerCPU, containerMemory int32
+	for _, c := range td.ContainerDefinitions {
+		containerCPU += c.Cpu
+		if c.MemoryReservation != nil {
+			containerMemory += aws.ToInt32(c.MemoryReservation)
+		} else {
+			containerMemory += aws.ToInt32(c.Memory)
+		}
+	}
+
+	if cpu == 0 {
+		cpu = containerCPU
+	}
+	if memory == 0 {
+		memory = containerMemory
+	}
+	return cpu, memory
+}
+
+// runsOnEC2 reports whether the task definition can be placed on container instances
+func runsOnEC2(td *ectypes.TaskDefinition) bool {
+	if len(td.RequiresCompatibilities) == 0 {
+		return true
+	}
+	for _, c := range td.RequiresCompatibilities {
+		if c == ectypes.CompatibilityEc2 || c == ectypes.CompatibilityExternal {
+			return true
+		}
+	}
+	return false
+}
+
+func atoi32(s string) int32 {
+	v, _ := strconv.Atoi(s)
+	return int32(v)
+}
+
+// utilizationBar renders used/total as a fixed width bar such as [######----] 60%
+func utilizationBar(used, total int32, width int) string {
+	if total <= 0 {
+		return "[" + strings.Repeat(" ", width) + "]   -"
+	}
+
+	filled := int(int64(used) * int64(width) / int64(total))
+	filled = max(0, min(filled, width))
+
+	return fmt.Sprintf("[%s%s] %3d%%", strings.Repeat("#", filled), strings.Repeat("-", width-filled), int64(used)*100/int64(total))
+}
+
+func printNodeDetails(n NodeOutput) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+
+	fmt.Fprintf(w, "Node:\t%s\n", n.ID)
+	fmt.Fprintf(w, "EC2 instance:\t%s\n", n.Ec2InstanceID)
+	fmt.Fprintf(w, "Status:\t%s (agent connected: %t)\n", n.Status, n.AgentConnected)
+	fmt.Fprintf(w, "Capacity provider:\t%s\n", valueOrDash(n.CapacityProvider))
+	fmt.Fprintf(w, "Type:\t%s in %s\n", valueOrDash(n.InstanceType), valueOrDash(n.AvailabilityZone))
+	fmt.Fprintf(w, "Private IP:\t%s\n", valueOrDash(n.PrivateIP))
+	fmt.Fprintf(w, "AMI:\t%s\n", valueOrDash(n.AmiID))
+	fmt.Fprintf(w, "Agent:\t%s\n", valueOrDash(n.AgentVersion))
+	if n.Instance.VersionInfo != nil {
+		fmt.Fprintf(w, "Docker:\t%s\n", valueOrDash(aws.ToString(n.Instance.VersionInfo.DockerVersion)))
+	}
+	if n.RegisteredGPU > 0 {
+		fmt.Fprintf(w, "GPU:\t%d free of %d\n", n.RemainingGPU, n.RegisteredGPU)
+	}
+	if len(n.UsedPorts) > 0 {
+		fmt.Fprintf(w, "Reserved ports:\t%s\n", strings.Join(n.UsedPorts, ","))
+	}
+
+	w.Flush()
+	fmt.Println()
+}
+
+func printNodeTasks(n NodeTasks) {
+	node := n.Node
+
+	fmt.Printf("%s  %s  %s  %s  %s  %d tasks\n", node.ID, node.Ec2InstanceID, valueOrDash(node.InstanceType), valueOrDash(node.AvailabilityZone), node.Status, len(n.Tasks))
+	fmt.Printf("  CPU     %s  %d/%d\n", utilizationBar(node.RegisteredCPU-node.RemainingCPU, node.RegisteredCPU, 30), node.RegisteredCPU-node.RemainingCPU, node.RegisteredCPU)
+	fmt.Printf("  MEMORY  %s  %d/%d MiB\n", utilizationBar(node.RegisteredMemory-node.RemainingMemory, node.RegisteredMemory, 30), node.RegisteredMemory-node.RemainingMemory, node.RegisteredMemory)
+	for _, size := range n.NoFit {
+		fmt.Printf("  ! cannot fit %s (%d CPU, %d MiB)\n", size.TaskDefinition, size.CPU, size.Memory)
+	}
+
+	if len(n.Tasks) > 0 {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "  TASK\tGROUP\tTASK DEFINITION\tCPU\tMEMORY\tSTATUS")
+		for _, t := range n.Tasks {
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%d\t%d\t%s\n", t.ID, t.Group, t.TaskDefinition, t.CPU, t.Memory, t.Status)
+		}
+		w.Flush()
+	}
+	fmt.Println()
+}
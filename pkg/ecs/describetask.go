@@ -9,6 +9,8 @@ import (
 
 	"strings"
 
+	"time"
+
 	"github.com/aws/aws-sdk-go-v2/aws"
 
 	"github.com/aws/aws-sdk-go-v2/service/ecs"
@@ -17,6 +19,8 @@ import (
 
 	"github.com/chnacib/nami/pkg/config"
 
+	"github.com/chnacib/nami/pkg/cw"
+
 	"github.com/spf13/cobra"
 )
 
@@ -24,6 +28,10 @@ func DescribeTask() *cobra.Command {
 
 	var cluster string
 
+	var metrics bool
+
+	var window time.Duration
+
 	cmd := &cobra.Command{
 
 		Use: "task [task-id]",
@@ -50,7 +58,9 @@ func DescribeTask() *cobra.Command {
 
 			if err != nil {
 
-				fmt.Errorf("failed to load configuration: %w", err)
+				fmt.Fprintf(os.Stderr, "Error: failed to load configuration: %v\n", err)
+
+				os.Exit(1)
 
 			}
 
@@ -86,6 +96,23 @@ func DescribeTask() *cobra.Command {
 			}
 			fmt.Println(string(data))
 
+			if !metrics {
+				return
+			}
+
+			usage, err := cw.GetTaskMetrics(context.Background(), cfg.AwsConfig, cluster, []string{NameArn(aws.ToString(response.Tasks[0].TaskArn))}, window)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: task metrics unavailable: %v\n", err)
+				return
+			}
+
+			m, ok := usage[NameArn(aws.ToString(response.Tasks[0].TaskArn))]
+			if !ok {
+				fmt.Fprintf(os.Stderr, "Warning: no Container Insights data for task %s in the last %s\n", taskID, window)
+				return
+			}
+			printTaskMetrics(m, window)
+
 		},
 	}
 
@@ -93,6 +120,10 @@ func DescribeTask() *cobra.Command {
 
 	cmd.MarkFlagRequired("cluster")
 
+	cmd.Flags().BoolVar(&metrics, "metrics", false, "Show task and container usage from Container Insights after the task")
+
+	cmd.Flags().DurationVar(&window, "window", 15*time.Minute, "Window the usage is computed over")
+
 	return cmd
 
 }
@@ -0,0 +1,223 @@
+package ecs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsecs "github.com/aws/aws-sdk-go-v2/service/ecs"
+	ectypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/chnacib/nami/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+// DrainNode returns the `nami drain node` command
+func DrainNode() *cobra.Command {
+	var (
+		cluster    string
+		wait       bool
+		timeoutSec int
+	)
+
+	cmd := &cobra.Command{
+		Use:     "node [id]",
+		Aliases: []string{"nodes"},
+		Short:   "Set a container instance to DRAINING and wait for its tasks to move",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			cfg, err := config.LoadConfig()
+			if err != nil {
+				return fmt.Errorf("failed to load configuration: %w", err)
+			}
+
+			client := awsecs.NewFromConfig(cfg.AwsConfig)
+
+			instance, err := resolveNode(ctx, client, cluster, args[0])
+			if err != nil {
+				return err
+			}
+
+			if err := setNodeState(ctx, client, cluster, instance, ectypes.ContainerInstanceStatusDraining); err != nil {
+				return err
+			}
+			fmt.Printf("Node %s (%s) is DRAINING\n", NameArn(aws.ToString(instance.ContainerInstanceArn)), aws.ToString(instance.Ec2InstanceId))
+
+			if !wait {
+				return nil
+			}
+
+			return waitNodeDrained(ctx, client, cluster, aws.ToString(instance.ContainerInstanceArn), time.Duration(timeoutSec)*time.Second)
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVarP(&cluster, "cluster", "c", "", "ECS Cluster name")
+	cmd.MarkFlagRequired("cluster")
+	cmd.Flags().BoolVar(&wait, "wait", true, "Wait until the service tasks on the node are rescheduled")
+	cmd.Flags().IntVar(&timeoutSec, "timeout", 1800, "Seconds to wait for the node to drain")
+
+	return cmd
+}
+
+// UndrainNode returns the `nami undrain node` command
+func UndrainNode() *cobra.Command {
+	var cluster string
+
+	cmd := &cobra.Command{
+		Use:     "node [id]",
+		Aliases: []string{"nodes"},
+		Short:   "Set a container instance back to ACTIVE",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			cfg, err := config.LoadConfig()
+			if err != nil {
+				return fmt.Errorf("failed to load configuration: %w", err)
+			}
+
+			client := awsecs.NewFromConfig(cfg.AwsConfig)
+
+			instance, err := resolveNode(ctx, client, cluster, args[0])
+			if err != nil {
+				return err
+			}
+
+			if err := setNodeState(ctx, client, cluster, instance, ectypes.ContainerInstanceStatusActive); err != nil {
+				return err
+			}
+
+			fmt.Printf("Node %s (%s) is ACTIVE\n", NameArn(aws.ToString(instance.ContainerInstanceArn)), aws.ToString(instance.Ec2InstanceId))
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVarP(&cluster, "cluster", "c", "", "ECS Cluster name")
+	cmd.MarkFlagRequired("cluster")
+
+	return cmd
+}
+
+// resolveNode describes a container instance given its ID, ARN or EC2 instance ID
+func resolveNode(ctx context.Context, client *awsecs.Client, cluster, id string) (*ectypes.ContainerInstance, error) {
+	if strings.HasPrefix(id, "i-") {
+		out, err := client.ListContainerInstances(ctx, &awsecs.ListContainerInstancesInput{
+			Cluster: aws.String(cluster),
+			Filter:  aws.String("ec2InstanceId == " + id),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("list container instances: %w", err)
+		}
+		if len(out.ContainerInstanceArns) == 0 {
+			return nil, fmt.Errorf("EC2 instance %s is not registered in cluster %q", id, cluster)
+		}
+		id = out.ContainerInstanceArns[0]
+	}
+
+	out, err := client.DescribeContainerInstances(ctx, &awsecs.DescribeContainerInstancesInput{
+		Cluster:            aws.String(cluster),
+		ContainerInstances: []string{id},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("describe container instance: %w", err)
+	}
+	if len(out.ContainerInstances) == 0 {
+		return nil, fmt.Errorf("node %q not found in cluster %q", id, cluster)
+	}
+
+	return &out.ContainerInstances[0], nil
+}
+
+func setNodeState(ctx context.Context, client *awsecs.Client, cluster string, instance *ectypes.ContainerInstance, status ectypes.ContainerInstanceStatus) error {
+	out, err := client.UpdateContainerInstancesState(ctx, &awsecs.UpdateContainerInstancesStateInput{
+		Cluster:            aws.String(cluster),
+		ContainerInstances: []string{aws.ToString(instance.ContainerInstanceArn)},
+		Status:             status,
+	})
+	if err != nil {
+		return fmt.Errorf("update container instance state: %w", err)
+	}
+	for _, failure := range out.Failures {
+		return fmt.Errorf("update container instance state: %s (%s)", aws.ToString(failure.Reason), aws.ToString(failure.Detail))
+	}
+
+	return nil
+}
+
+// waitNodeDrained polls the tasks on the node until no service task is left. Standalone tasks are not
+// rescheduled by draining, so they are reported and left running.
+func waitNodeDrained(ctx context.Context, client *awsecs.Client, cluster, instanceArn string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	last := -1
+
+	for {
+		serviceTasks, standalone, err := nodeTasks(ctx, client, cluster, instanceArn)
+		if err != nil {
+			return err
+		}
+
+		if len(serviceTasks) != last {
+			fmt.Printf("%d tasks remaining\n", len(serviceTasks))
+			last = len(serviceTasks)
+		}
+
+		if len(serviceTasks) == 0 {
+			if len(standalone) > 0 {
+				fmt.Printf("Node drained, %d standalone tasks are still running and will not be rescheduled:\n", len(standalone))
+				for _, task := range standalone {
+					fmt.Printf("  %s\t%s\n", NameArn(aws.ToString(task.TaskArn)), NameArn(aws.ToString(task.TaskDefinitionArn)))
+				}
+				return nil
+			}
+			fmt.Println("Node drained")
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out after %s with %d tasks still on the node", timeout, len(serviceTasks))
+		}
+		time.Sleep(10 * time.Second)
+	}
+}
+
+// nodeTasks returns the service and standalone tasks placed on the container instance
+func nodeTasks(ctx context.Context, client *awsecs.Client, cluster, instanceArn string) ([]ectypes.Task, []ectypes.Task, error) {
+	var arns []string
+	paginator := awsecs.NewListTasksPaginator(client, &awsecs.ListTasksInput{
+		Cluster:           aws.String(cluster),
+		ContainerInstance: aws.String(instanceArn),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("list tasks: %w", err)
+		}
+		arns = append(arns, page.TaskArns...)
+	}
+
+	var serviceTasks, standalone []ectypes.Task
+	for start := 0; start < len(arns); start += 100 {
+		end := min(start+100, len(arns))
+		out, err := client.DescribeTasks(ctx, &awsecs.DescribeTasksInput{
+			Cluster: aws.String(cluster),
+			Tasks:   arns[start:end],
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("describe tasks: %w", err)
+		}
+		for _, task := range out.Tasks {
+			if strings.HasPrefix(aws.ToString(task.Group), "service:") {
+				serviceTasks = append(serviceTasks, task)
+			} else {
+				standalone = append(standalone, task)
+			}
+		}
+	}
+
+	return serviceTasks, standalone, nil
+}
@@ -0,0 +1,341 @@
+package ecs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsecs "github.com/aws/aws-sdk-go-v2/service/ecs"
+	ectypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	smtypes "github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/chnacib/nami/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+type EnvOptions struct {
+	Cluster     string
+	Service     string
+	Container   string
+	Resolve     bool
+	ShowSecrets bool // print resolved secret values instead of masking them
+}
+
+// EnvEntry is a single environment variable, environment file or secret reference of a container
+type EnvEntry struct {
+	Container string
+	Kind      string // ENV, FILE or SECRET
+	Name      string
+	Value     string
+	Status    string // only set for secrets when resolving
+}
+
+// ListEnv returns the `nami get env` command
+func ListEnv() *cobra.Command {
+	var cluster string
+	var container string
+	var resolve bool
+	var showSecrets bool
+
+	cmd := &cobra.Command{
+		Use:     "env [service]",
+		Aliases: []string{"environment"},
+		Short:   "Show the effective environment of a service",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			resolve = resolve || showSecrets
+			entries, err := GetServiceEnv(cmd.Context(), EnvOptions{
+				Cluster:     cluster,
+				Service:     args[0],
+				Container:   container,
+				Resolve:     resolve,
+				ShowSecrets: showSecrets,
+			})
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+			if resolve {
+				fmt.Fprintln(w, "CONTAINER\tTYPE\tNAME\tVALUE\tSTATUS")
+			} else {
+				fmt.Fprintln(w, "CONTAINER\tTYPE\tNAME\tVALUE")
+			}
+
+			for _, e := range entries {
+				if resolve {
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", e.Container, e.Kind, e.Name, e.Value, e.Status)
+				} else {
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", e.Container, e.Kind, e.Name, e.Value)
+				}
+			}
+
+			w.Flush()
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVarP(&cluster, "cluster", "c", "", "ECS Cluster name")
+	cmd.MarkFlagRequired("cluster")
+	cmd.Flags().StringVar(&container, "container", "", "Only show this container")
+	cmd.Flags().BoolVar(&resolve, "resolve", false, "Fetch secret values (masked) and check the execution role can read them")
+	cmd.Flags().BoolVar(&showSecrets, "show-secrets", false, "Print resolved secret values in clear text (implies --resolve)")
+
+	return cmd
+}
+
+// GetServiceEnv lists the environment of the task definition the service is currently running
+func GetServiceEnv(ctx context.Context, options EnvOptions) ([]EnvEntry, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	client := awsecs.NewFromConfig(cfg.AwsConfig)
+
+	_, td, err := describeServiceTaskDefinition(ctx, client, options.Cluster, options.Service)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []EnvEntry
+	found := false
+	for _, c := range td.ContainerDefinitions {
+		name := aws.ToString(c.Name)
+		if options.Container != "" && options.Container != name {
+			continue
+		}
+		found = true
+		entries = append(entries, containerEnv(c)...)
+	}
+
+	if options.Container != "" && !found {
+		return nil, fmt.Errorf("container %q not found in task definition %q", options.Container, aws.ToString(td.TaskDefinitionArn))
+	}
+
+	if options.Resolve {
+		resolver := &secretResolver{
+			ssm:     ssm.NewFromConfig(cfg.AwsConfig),
+			secrets: secretsmanager.NewFromConfig(cfg.AwsConfig),
+			iam:     iam.NewFromConfig(cfg.AwsConfig),
+			role:    aws.ToString(td.ExecutionRoleArn),
+			region:  cfg.AwsConfig.Region,
+			account: arnAccount(aws.ToString(td.TaskDefinitionArn)),
+			show:    options.ShowSecrets,
+		}
+
+		for i := range entries {
+			if entries[i].Kind != "SECRET" {
+				continue
+			}
+			entries[i].Value, entries[i].Status = resolver.resolve(ctx, entries[i].Value)
+		}
+	}
+
+	return entries, nil
+}
+
+func containerEnv(c ectypes.ContainerDefinition) []EnvEntry {
+	name := aws.ToString(c.Name)
+	var entries []EnvEntry
+
+	env := make([]EnvEntry, 0, len(c.Environment))
+	for _, kv := range c.Environment {
+		env = append(env, EnvEntry{Container: name, Kind: "ENV", Name: aws.ToString(kv.Name), Value: aws.ToString(kv.Value)})
+	}
+	sort.Slice(env, func(i, j int) bool { return env[i].Name < env[j].Name })
+	entries = append(entries, env...)
+
+	for _, f := range c.EnvironmentFiles {
+		entries = append(entries, EnvEntry{Container: name, Kind: "FILE", Name: string(f.Type), Value: aws.ToString(f.Value)})
+	}
+
+	secrets := make([]EnvEntry, 0, len(c.Secrets))
+	for _, s := range c.Secrets {
+		secrets = append(secrets, EnvEntry{Container: name, Kind: "SECRET", Name: aws.ToString(s.Name), Value: aws.ToString(s.ValueFrom)})
+	}
+	sort.Slice(secrets, func(i, j int) bool { return secrets[i].Name < secrets[j].Name })
+	entries = append(entries, secrets...)
+
+	return entries
+}
+
+type secretResolver struct {
+	ssm     *ssm.Client
+	secrets *secretsmanager.Client
+	iam     *iam.Client
+	role    string
+	region  string
+	account string
+	show    bool // return values in clear text instead of masked
+}
+
+// resolve fetches the secret referenced by valueFrom and returns its value, masked unless show is set, and a status
+func (r *secretResolver) resolve(ctx context.Context, valueFrom string) (string, string) {
+	var value, resource, action string
+	var err error
+
+	if strings.HasPrefix(valueFrom, "arn:") && strings.Contains(valueFrom, ":secretsmanager:") {
+		ref := splitSecretArn(valueFrom)
+		resource, action = ref.Arn, "secretsmanager:GetSecretValue"
+		value, err = r.secretValue(ctx, ref)
+	} else {
+		resource, action = r.parameterArn(valueFrom), "ssm:GetParameters"
+		value, err = r.parameterValue(ctx, valueFrom)
+	}
+
+	if err != nil {
+		var paramNotFound *ssmtypes.ParameterNotFound
+		var secretNotFound *smtypes.ResourceNotFoundException
+		switch {
+		case errors.As(err, &paramNotFound), errors.As(err, &secretNotFound):
+			return valueFrom, "NOT FOUND"
+		default:
+			return valueFrom, fmt.Sprintf("ERROR: %v", err)
+		}
+	}
+
+	status := "OK"
+	if r.role == "" {
+		status = "NO EXECUTION ROLE"
+	} else if allowed, err := r.canRead(ctx, action, resource); err != nil {
+		status = "OK (role not checked)"
+	} else if !allowed {
+		status = "EXECUTION ROLE DENIED"
+	}
+
+	if r.show {
+		return value, status
+	}
+	return maskValue(value), status
+}
+
+func (r *secretResolver) parameterValue(ctx context.Context, name string) (string, error) {
+	if strings.HasPrefix(name, "arn:") {
+		name = name[strings.Index(name, ":parameter")+len(":parameter"):]
+		// parameter/name is the ARN of a top-level "name", parameter/a/b the ARN of "/a/b"
+		if strings.Count(name, "/") == 1 {
+			name = strings.TrimPrefix(name, "/")
+		}
+	}
+
+	out, err := r.ssm.GetParameter(ctx, &ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return aws.ToString(out.Parameter.Value), nil
+}
+
+func (r *secretResolver) secretValue(ctx context.Context, ref secretRef) (string, error) {
+	input := &secretsmanager.GetSecretValueInput{SecretId: aws.String(ref.Arn)}
+	if ref.VersionStage != "" {
+		input.VersionStage = aws.String(ref.VersionStage)
+	}
+	if ref.VersionID != "" {
+		input.VersionId = aws.String(ref.VersionID)
+	}
+
+	out, err := r.secrets.GetSecretValue(ctx, input)
+	if err != nil {
+		return "", err
+	}
+
+	value := aws.ToString(out.SecretString)
+	jsonKey := ref.JSONKey
+	if jsonKey == "" {
+		return value, nil
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &doc); err != nil {
+		return "", fmt.Errorf("secret is not JSON, cannot read key %q", jsonKey)
+	}
+	v, ok := doc[jsonKey]
+	if !ok {
+		return "", fmt.Errorf("key %q not found in secret", jsonKey)
+	}
+
+	return fmt.Sprint(v), nil
+}
+
+// canRead simulates the execution role policy for action on resource
+func (r *secretResolver) canRead(ctx context.Context, action, resource string) (bool, error) {
+	out, err := r.iam.SimulatePrincipalPolicy(ctx, &iam.SimulatePrincipalPolicyInput{
+		PolicySourceArn: aws.String(r.role),
+		ActionNames:     []string{action},
+		ResourceArns:    []string{resource},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	for _, result := range out.EvaluationResults {
+		if result.EvalDecision != iamtypes.PolicyEvaluationDecisionTypeAllowed {
+			return false, nil
+		}
+	}
+
+	return len(out.EvaluationResults) > 0, nil
+}
+
+func (r *secretResolver) parameterArn(name string) string {
+	if strings.HasPrefix(name, "arn:") {
+		return name
+	}
+	if !strings.HasPrefix(name, "/") {
+		name = "/" + name
+	}
+	return fmt.Sprintf("arn:aws:ssm:%s:%s:parameter%s", r.region, r.account, name)
+}
+
+// secretRef is a Secrets Manager valueFrom split into its parts, the optional ones are empty when omitted
+type secretRef struct {
+	Arn          string
+	JSONKey      string
+	VersionStage string
+	VersionID    string
+}
+
+// splitSecretArn separates a Secrets Manager valueFrom into the secret ARN and its optional parts
+// Format: arn:aws:secretsmanager:region:account:secret:name[:json-key:version-stage:version-id]
+func splitSecretArn(valueFrom string) secretRef {
+	parts := strings.Split(valueFrom, ":")
+	if len(parts) <= 7 {
+		return secretRef{Arn: valueFrom}
+	}
+
+	ref := secretRef{Arn: strings.Join(parts[:7], ":")}
+	optional := make([]string, 3)
+	copy(optional, parts[7:])
+	ref.JSONKey, ref.VersionStage, ref.VersionID = optional[0], optional[1], optional[2]
+	return ref
+}
+
+// arnAccount returns the account ID field of an ARN
+func arnAccount(arn string) string {
+	parts := strings.Split(arn, ":")
+	if len(parts) < 5 {
+		return ""
+	}
+	return parts[4]
+}
+
+// maskValue hides a secret completely, the mask does not depend on the value or its length
+func maskValue(string) string {
+	return "******"
+}
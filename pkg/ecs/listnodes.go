@@ -1,83 +1,296 @@
 package ecs
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"os"
+	"sort"
+	"strings"
 	"text/tabwriter"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	awsecs "github.com/aws/aws-sdk-go-v2/service/ecs"
+	ectypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/chnacib/nami/pkg/config"
 	"github.com/spf13/cobra"
 )
 
+type NodeOutput struct {
+	ID               string
+	Arn              string
+	Ec2InstanceID    string
+	CapacityProvider string
+	PrivateIP        string
+	InstanceType     string
+	AvailabilityZone string
+	AmiID            string
+	AgentVersion     string
+	AgentConnected   bool
+	Status           string
+	RegisteredCPU    int32
+	RegisteredMemory int32
+	RegisteredGPU    int
+	RemainingCPU     int32
+	RemainingMemory  int32
+	RemainingGPU     int
+	UsedPorts        []string // host ports reserved by tasks, the remaining PORTS resource
+	RunningTasks     int32
+	PendingTasks     int32
+	Instance         ectypes.ContainerInstance
+}
+
 func ListNodes() *cobra.Command {
 	var cluster string
-	var container_instances []string
+	var tasks bool
 
 	cmd := &cobra.Command{
 		Use:     "nodes",
 		Aliases: []string{"node"},
-		Short:   "List ECS instances in default region",
-		Run: func(cmd *cobra.Command, args []string) {
-			sess := session.Must(session.NewSessionWithOptions(session.Options{
-				SharedConfigState: session.SharedConfigEnable,
-			}))
-
-			client := ecs.New(sess)
+		Short:   "List ECS container instances of a cluster",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if tasks {
+				nodes, err := GetNodeTasks(cmd.Context(), cluster)
+				if err != nil {
+					return err
+				}
+				if len(nodes) == 0 {
+					return printNoNodes(cmd.Context(), cluster)
+				}
 
-			list_input := &ecs.ListContainerInstancesInput{
-				Cluster:    aws.String(cluster),
-				MaxResults: aws.Int64(100),
+				for _, n := range nodes {
+					printNodeTasks(n)
+				}
+				return nil
 			}
 
-			list_response, err := client.ListContainerInstances(list_input)
+			nodes, err := GetNodes(cmd.Context(), cluster)
 			if err != nil {
-				log.Fatal("Nodes not found for cluster")
+				return err
 			}
-			w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
-			fmt.Fprintln(w, "NAME\tNETWORK\tSIZE\tREGISTERED CPU\tREGISTERED MEMORY\tREMAINING CPU\tREMAINING MEMORY\tSTATUS")
 
-			for _, container_instance_arn := range list_response.ContainerInstanceArns {
-				container_instance := NameArn(*container_instance_arn)
-				container_instances = append(container_instances, container_instance)
+			if len(nodes) == 0 {
+				return printNoNodes(cmd.Context(), cluster)
 			}
 
-			describe_input := &ecs.DescribeContainerInstancesInput{
-				Cluster:            aws.String(cluster),
-				ContainerInstances: aws.StringSlice(container_instances),
-			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+			fmt.Fprintln(w, "ID\tINSTANCE\tCAPACITY PROVIDER\tIP\tTYPE\tAZ\tAMI\tAGENT\tCPU FREE\tMEMORY FREE\tGPU FREE\tTASKS\tSTATUS")
 
-			describe_response, err := client.DescribeContainerInstances(describe_input)
-			if err != nil {
-				log.Fatal(err)
-			}
+			for _, n := range nodes {
+				gpu := "-"
+				if n.RegisteredGPU > 0 {
+					gpu = fmt.Sprintf("%d/%d", n.RemainingGPU, n.RegisteredGPU)
+				}
 
-			for _, output_container_instance := range describe_response.ContainerInstances {
-				capacity_provider_name := *output_container_instance.CapacityProviderName
-				remaining_cpu := *output_container_instance.RemainingResources[0].IntegerValue
-				remaining_memory := *output_container_instance.RemainingResources[1].IntegerValue
-				registered_cpu := *output_container_instance.RegisteredResources[0].IntegerValue
-				registered_memory := *output_container_instance.RegisteredResources[1].IntegerValue
-				status := *output_container_instance.Status
-				private_ipv4 := *output_container_instance.Attachments[0].Details[4].Value
-				var instance_type string
-				for _, attribute := range output_container_instance.Attributes {
-					if *attribute.Name == "ecs.instance-type" {
-						instance_type = *attribute.Value
-						break
-					}
+				status := n.Status
+				if !n.AgentConnected {
+					status += " (agent disconnected)"
 				}
-				fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%d\t%d\t%s\n", capacity_provider_name, private_ipv4, instance_type, registered_cpu, registered_memory, remaining_cpu, remaining_memory, status)
 
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d/%d\t%d/%d\t%s\t%d\t%s\n",
+					n.ID, n.Ec2InstanceID, valueOrDash(n.CapacityProvider), valueOrDash(n.PrivateIP),
+					valueOrDash(n.InstanceType), valueOrDash(n.AvailabilityZone), valueOrDash(n.AmiID), valueOrDash(n.AgentVersion),
+					n.RemainingCPU, n.RegisteredCPU, n.RemainingMemory, n.RegisteredMemory, gpu,
+					n.RunningTasks, status)
 			}
-			w.Flush()
 
+			w.Flush()
+			return nil
 		},
+		SilenceUsage: true,
 	}
-	cmd.Flags().StringVarP(&cluster, "cluster", "c", "string", "ECS Cluster name")
+	cmd.Flags().StringVarP(&cluster, "cluster", "c", "", "ECS Cluster name")
 	cmd.MarkFlagRequired("cluster")
+	cmd.Flags().BoolVar(&tasks, "tasks", false, "Group running tasks under each node with their reserved CPU and memory")
 
 	return cmd
 }
+
+// GetNodes returns every container instance registered in the cluster, sorted by availability zone and ID
+func GetNodes(ctx context.Context, cluster string) ([]NodeOutput, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	client := awsecs.NewFromConfig(cfg.AwsConfig)
+
+	var arns []string
+	paginator := awsecs.NewListContainerInstancesPaginator(client, &awsecs.ListContainerInstancesInput{
+		Cluster: aws.String(cluster),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("list container instances: %w", err)
+		}
+		arns = append(arns, page.ContainerInstanceArns...)
+	}
+
+	var nodes []NodeOutput
+	for start := 0; start < len(arns); start += 100 {
+		end := min(start+100, len(arns))
+		out, err := client.DescribeContainerInstances(ctx, &awsecs.DescribeContainerInstancesInput{
+			Cluster:            aws.String(cluster),
+			ContainerInstances: arns[start:end],
+		})
+		if err != nil {
+			return nil, fmt.Errorf("describe container instances: %w", err)
+		}
+
+		for _, ci := range out.ContainerInstances {
+			nodes = append(nodes, nodeOutput(ci))
+		}
+	}
+
+	fillPrivateIPs(ctx, cfg.AwsConfig, nodes)
+
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].AvailabilityZone != nodes[j].AvailabilityZone {
+			return nodes[i].AvailabilityZone < nodes[j].AvailabilityZone
+		}
+		return nodes[i].ID < nodes[j].ID
+	})
+
+	return nodes, nil
+}
+
+// fillPrivateIPs sets the private IPs of the nodes from EC2, the ENI attachment only exists with awsvpc trunking
+func fillPrivateIPs(ctx context.Context, cfg aws.Config, nodes []NodeOutput) {
+	var ids []string
+	index := make(map[string]int)
+	for i, n := range nodes {
+		if n.Ec2InstanceID != "" {
+			ids = append(ids, n.Ec2InstanceID)
+			index[n.Ec2InstanceID] = i
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	instances := ec2.NewDescribeInstancesPaginator(ec2.NewFromConfig(cfg), &ec2.DescribeInstancesInput{InstanceIds: ids})
+	for instances.HasMorePages() {
+		page, err := instances.NextPage(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: describe EC2 instances: %v\n", err)
+			return
+		}
+		for _, r := range page.Reservations {
+			for _, inst := range r.Instances {
+				if i, ok := index[aws.ToString(inst.InstanceId)]; ok && inst.PrivateIpAddress != nil {
+					nodes[i].PrivateIP = aws.ToString(inst.PrivateIpAddress)
+				}
+			}
+		}
+	}
+}
+
+func nodeOutput(ci ectypes.ContainerInstance) NodeOutput {
+	n := NodeOutput{
+		ID:               NameArn(aws.ToString(ci.ContainerInstanceArn)),
+		Arn:              aws.ToString(ci.ContainerInstanceArn),
+		Ec2InstanceID:    aws.ToString(ci.Ec2InstanceId),
+		CapacityProvider: aws.ToString(ci.CapacityProviderName),
+		AgentConnected:   ci.AgentConnected,
+		Status:           aws.ToString(ci.Status),
+		RunningTasks:     ci.RunningTasksCount,
+		PendingTasks:     ci.PendingTasksCount,
+		RegisteredCPU:    resourceInt(ci.RegisteredResources, "CPU"),
+		RegisteredMemory: resourceInt(ci.RegisteredResources, "MEMORY"),
+		RegisteredGPU:    len(resourceSet(ci.RegisteredResources, "GPU")),
+		RemainingCPU:     resourceInt(ci.RemainingResources, "CPU"),
+		RemainingMemory:  resourceInt(ci.RemainingResources, "MEMORY"),
+		RemainingGPU:     len(resourceSet(ci.RemainingResources, "GPU")),
+		UsedPorts:        resourceSet(ci.RemainingResources, "PORTS"),
+		Instance:         ci,
+	}
+
+	if ci.VersionInfo != nil {
+		n.AgentVersion = aws.ToString(ci.VersionInfo.AgentVersion)
+	}
+
+	for _, attr := range ci.Attributes {
+		switch aws.ToString(attr.Name) {
+		case "ecs.instance-type":
+			n.InstanceType = aws.ToString(attr.Value)
+		case "ecs.availability-zone":
+			n.AvailabilityZone = aws.ToString(attr.Value)
+		case "ecs.ami-id":
+			n.AmiID = aws.ToString(attr.Value)
+		}
+	}
+
+	for _, attachment := range ci.Attachments {
+		for _, detail := range attachment.Details {
+			if aws.ToString(detail.Name) == "privateIPv4Address" {
+				n.PrivateIP = aws.ToString(detail.Value)
+			}
+		}
+	}
+
+	return n
+}
+
+// resourceInt returns an INTEGER resource such as CPU or MEMORY by name
+func resourceInt(resources []ectypes.Resource, name string) int32 {
+	for _, r := range resources {
+		if aws.ToString(r.Name) == name {
+			return r.IntegerValue
+		}
+	}
+	return 0
+}
+
+// resourceSet returns a STRINGSET resource such as PORTS or GPU by name
+func resourceSet(resources []ectypes.Resource, name string) []string {
+	for _, r := range resources {
+		if aws.ToString(r.Name) == name {
+			return r.StringSetValue
+		}
+	}
+	return nil
+}
+
+// printNoNodes explains why the cluster has no container instances
+func printNoNodes(ctx context.Context, cluster string) error {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	out, err := awsecs.NewFromConfig(cfg.AwsConfig).DescribeClusters(ctx, &awsecs.DescribeClustersInput{Clusters: []string{cluster}})
+	if err != nil {
+		return fmt.Errorf("describe cluster: %w", err)
+	}
+	if len(out.Clusters) == 0 || aws.ToString(out.Clusters[0].Status) == "INACTIVE" {
+		return fmt.Errorf("cluster %q not found", cluster)
+	}
+
+	var fargate, others []string
+	for _, provider := range out.Clusters[0].CapacityProviders {
+		if strings.HasPrefix(provider, "FARGATE") {
+			fargate = append(fargate, provider)
+		} else {
+			others = append(others, provider)
+		}
+	}
+
+	switch {
+	case len(others) > 0:
+		fmt.Printf("No container instances registered in %s yet (capacity providers: %s)\n", cluster, strings.Join(others, ", "))
+	case len(fargate) > 0:
+		fmt.Printf("Cluster %s runs on Fargate only (%s), it has no EC2 nodes\n", cluster, strings.Join(fargate, ", "))
+	default:
+		fmt.Printf("No container instances registered in %s\n", cluster)
+	}
+
+	return nil
+}
+
+func valueOrDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
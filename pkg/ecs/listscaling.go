@@ -3,151 +3,289 @@ package ecs
 import (
 	"context"
 	"fmt"
-	"log"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"text/tabwriter"
 
-	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/applicationautoscaling"
 	"github.com/aws/aws-sdk-go-v2/service/applicationautoscaling/types"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/chnacib/nami/pkg/config"
 	"github.com/spf13/cobra"
 )
 
+type AutoscalingOutput struct {
+	Service   string
+	Running   int32
+	Desired   int32
+	Min       *int32
+	Max       *int32
+	Suspended string
+	Policies  []string
+	Err       error
+}
+
 func ListAutoscaling() *cobra.Command {
 	var cluster string
 
 	cmd := &cobra.Command{
 		Use:     "autoscaling",
 		Aliases: []string{"as", "autoscale"},
-		Short:   "list ECS services",
-		Run: func(cmd *cobra.Command, args []string) {
-			sess := session.Must(session.NewSessionWithOptions(session.Options{
-				SharedConfigState: session.SharedConfigEnable,
-			}))
-			cfg, err := config.LoadDefaultConfig(context.TODO())
+		Short:   "list ECS services autoscaling",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			rows, err := GetAutoscaling(cmd.Context(), cluster)
 			if err != nil {
-				log.Fatal()
+				return err
 			}
-			client_ecs := ecs.New(sess)
 
-			client_app := applicationautoscaling.NewFromConfig(cfg)
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+			fmt.Fprintln(w, "SERVICE\tRUNNING\tDESIRED\tMIN\tMAX\tSUSPENDED\tTARGETS")
 
-			input := &ecs.ListServicesInput{
-				Cluster:    aws.String(cluster),
-				MaxResults: aws.Int64(100),
-			}
+			failed := 0
+			for _, row := range rows {
+				targets := strings.Join(row.Policies, " | ")
+				if row.Err != nil {
+					targets = "ERROR"
+					failed++
+				} else if targets == "" {
+					targets = "-"
+				}
 
-			response, err := client_ecs.ListServices(input)
-			if err != nil {
-				fmt.Println(err)
-				os.Exit(0)
+				fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\t%s\t%s\n", row.Service, row.Running, row.Desired,
+					formatCapacity(row.Min), formatCapacity(row.Max), row.Suspended, targets)
 			}
+			w.Flush()
 
-			w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
-			fmt.Fprintln(w, "SERVICE\tRUNNING\tDESIRED\tMIN\tMAX\tTARGETS")
-
-			policyCache := make(map[string]string)
-			var policyCacheMutex sync.Mutex
-
-			var wg sync.WaitGroup
-			for _, serviceArn := range response.ServiceArns {
-				wg.Add(1)
-				serviceArnCopy := *serviceArn
-				go func(serviceArn string) {
-					defer wg.Done()
-
-					service := NameArn(serviceArn)
-
-					input_target := &applicationautoscaling.DescribeScalableTargetsInput{
-						ServiceNamespace: types.ServiceNamespaceEcs,
-						MaxResults:       aws.Int32(100),
-						ResourceIds: []string{
-							*aws.String(fmt.Sprintf("service/%s/%s", cluster, service)),
-						},
-						ScalableDimension: types.ScalableDimensionECSServiceDesiredCount,
-					}
-
-					output_target, err := client_app.DescribeScalableTargets(context.TODO(), input_target)
-					if err != nil {
-						fmt.Println(err)
-						os.Exit(0)
-					}
-
-					input_svc := &ecs.DescribeServicesInput{
-						Services: []*string{
-							aws.String(service),
-						},
-						Cluster: aws.String(cluster),
-					}
-
-					output_svc, err := client_ecs.DescribeServices(input_svc)
-					if err != nil {
-						fmt.Println(err)
-						os.Exit(0)
-					}
-
-					desired := aws.Int64Value(output_svc.Services[0].DesiredCount)
-					running := aws.Int64Value(output_svc.Services[0].RunningCount)
-
-					var min_capacity, max_capacity int32
-					for _, scalable_targets := range output_target.ScalableTargets {
-						min_capacity = aws.Int32Value(scalable_targets.MinCapacity)
-						max_capacity = aws.Int32Value(scalable_targets.MaxCapacity)
-					}
-
-					input_policy := &applicationautoscaling.DescribeScalingPoliciesInput{
-						ServiceNamespace:  types.ServiceNamespaceEcs,
-						ResourceId:        aws.String(fmt.Sprintf("service/%s/%s", cluster, service)),
-						ScalableDimension: types.ScalableDimensionECSServiceDesiredCount,
-					}
-					output_policy, err := client_app.DescribeScalingPolicies(context.TODO(), input_policy)
-					if err != nil {
-						fmt.Println(err)
-						os.Exit(0)
-					}
-
-					var policyResult strings.Builder
-					for _, policies := range output_policy.ScalingPolicies {
-						var policyValue string
-						policy := *&policies.TargetTrackingScalingPolicyConfiguration.PredefinedMetricSpecification.PredefinedMetricType
-						switch policy {
-						case "ALBRequestCountPerTarget":
-							policyValue = "REQUESTS"
-						case "ECSServiceAverageCPUUtilization":
-							policyValue = "CPU"
-						case "ECSServiceAverageMemoryUtilization":
-							policyValue = "MEMORY"
-						}
-
-						target_value := aws.Float64Value(policies.TargetTrackingScalingPolicyConfiguration.TargetValue)
-						if policyResult.Len() > 0 {
-							policyResult.WriteString(" | ")
-						}
-
-						policyResult.WriteString(fmt.Sprintf("%s:%s", policyValue, strconv.FormatFloat(target_value, 'f', -1, 64)))
-					}
-
-					policyCacheMutex.Lock()
-					policyCache[serviceArn] = policyResult.String()
-					policyCacheMutex.Unlock()
-
-					fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%s\n", service, running, desired, min_capacity, max_capacity, policyCache[serviceArn])
-				}(serviceArnCopy)
+			for _, row := range rows {
+				if row.Err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: %s: %v\n", row.Service, row.Err)
+				}
+			}
+			if failed > 0 {
+				return fmt.Errorf("failed to read autoscaling for %d of %d services", failed, len(rows))
 			}
 
-			wg.Wait()
-			w.Flush()
+			return nil
 		},
+		SilenceUsage: true,
 	}
 
-	cmd.Flags().StringVarP(&cluster, "cluster", "c", "string", "ECS Cluster name")
+	cmd.Flags().StringVarP(&cluster, "cluster", "c", "", "ECS Cluster name")
 	cmd.MarkFlagRequired("cluster")
 
 	return cmd
 }
+
+// GetAutoscaling returns the autoscaling configuration of every service in cluster, sorted by service name.
+// Errors reading a single service are reported in its Err field.
+func GetAutoscaling(ctx context.Context, cluster string) ([]AutoscalingOutput, error) {
+	services, err := GetECSServices(ctx, ServiceOptions{Cluster: cluster})
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	client := applicationautoscaling.NewFromConfig(cfg.AwsConfig)
+
+	rows := make([]AutoscalingOutput, len(services))
+	index := make(map[string]int, len(services))
+	for i, svc := range services {
+		rows[i] = AutoscalingOutput{
+			Service:   svc.Service,
+			Running:   svc.RunningCount,
+			Desired:   svc.DesiredCount,
+			Suspended: "-",
+		}
+		index[fmt.Sprintf("service/%s/%s", cluster, svc.Service)] = i
+	}
+
+	// DescribeScalableTargets accepts up to 50 resource IDs per call
+	for start := 0; start < len(rows); start += 50 {
+		end := start + 50
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		var ids []string
+		for _, row := range rows[start:end] {
+			ids = append(ids, fmt.Sprintf("service/%s/%s", cluster, row.Service))
+		}
+
+		paginator := applicationautoscaling.NewDescribeScalableTargetsPaginator(client, &applicationautoscaling.DescribeScalableTargetsInput{
+			ServiceNamespace:  types.ServiceNamespaceEcs,
+			ScalableDimension: types.ScalableDimensionECSServiceDesiredCount,
+			ResourceIds:       ids,
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				for i := start; i < end; i++ {
+					rows[i].Err = fmt.Errorf("describe scalable targets: %w", err)
+				}
+				break
+			}
+
+			for _, target := range page.ScalableTargets {
+				i, ok := index[aws.ToString(target.ResourceId)]
+				if !ok {
+					continue
+				}
+				rows[i].Min = target.MinCapacity
+				rows[i].Max = target.MaxCapacity
+				rows[i].Suspended = suspendedState(target.SuspendedState)
+			}
+		}
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, 10)
+	for i := range rows {
+		if rows[i].Err != nil || rows[i].Min == nil {
+			continue
+		}
+
+		wg.Add(1)
+		go func(row *AutoscalingOutput) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			row.Policies, row.Err = scalingPolicies(ctx, client, fmt.Sprintf("service/%s/%s", cluster, row.Service))
+		}(&rows[i])
+	}
+	wg.Wait()
+
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Service < rows[j].Service })
+
+	return rows, nil
+}
+
+func scalingPolicies(ctx context.Context, client *applicationautoscaling.Client, resourceID string) ([]string, error) {
+	var policies []string
+
+	paginator := applicationautoscaling.NewDescribeScalingPoliciesPaginator(client, &applicationautoscaling.DescribeScalingPoliciesInput{
+		ServiceNamespace:  types.ServiceNamespaceEcs,
+		ResourceId:        aws.String(resourceID),
+		ScalableDimension: types.ScalableDimensionECSServiceDesiredCount,
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("describe scaling policies: %w", err)
+		}
+
+		for _, policy := range page.ScalingPolicies {
+			policies = append(policies, formatPolicy(policy))
+		}
+	}
+
+	sort.Strings(policies)
+	return policies, nil
+}
+
+// formatPolicy renders a scaling policy of any type as a short TARGETS entry
+func formatPolicy(policy types.ScalingPolicy) string {
+	name := aws.ToString(policy.PolicyName)
+
+	switch policy.PolicyType {
+	case types.PolicyTypeTargetTrackingScaling:
+		tt := policy.TargetTrackingScalingPolicyConfiguration
+		if tt == nil {
+			return "TARGET:" + name
+		}
+
+		var metric string
+		switch {
+		case tt.PredefinedMetricSpecification != nil:
+			switch tt.PredefinedMetricSpecification.PredefinedMetricType {
+			case types.MetricTypeALBRequestCountPerTarget:
+				metric = "REQUESTS"
+			case types.MetricTypeECSServiceAverageCPUUtilization:
+				metric = "CPU"
+			case types.MetricTypeECSServiceAverageMemoryUtilization:
+				metric = "MEMORY"
+			default:
+				metric = string(tt.PredefinedMetricSpecification.PredefinedMetricType)
+			}
+		case tt.CustomizedMetricSpecification != nil:
+			custom := tt.CustomizedMetricSpecification
+			if len(custom.Metrics) > 0 {
+				metric = "METRIC-MATH(" + name + ")"
+			} else {
+				metric = fmt.Sprintf("%s/%s(%s)", aws.ToString(custom.Namespace), aws.ToString(custom.MetricName), custom.Statistic)
+			}
+		default:
+			metric = name
+		}
+
+		entry := fmt.Sprintf("%s:%s", metric, strconv.FormatFloat(aws.ToFloat64(tt.TargetValue), 'f', -1, 64))
+		if aws.ToBool(tt.DisableScaleIn) {
+			entry += "(no scale-in)"
+		}
+		return entry
+
+	case types.PolicyTypeStepScaling:
+		step := policy.StepScalingPolicyConfiguration
+		if step == nil {
+			return "STEP:" + name
+		}
+
+		var steps []string
+		for _, adj := range step.StepAdjustments {
+			lower, upper := "", ""
+			if adj.MetricIntervalLowerBound != nil {
+				lower = strconv.FormatFloat(*adj.MetricIntervalLowerBound, 'f', -1, 64)
+			}
+			if adj.MetricIntervalUpperBound != nil {
+				upper = strconv.FormatFloat(*adj.MetricIntervalUpperBound, 'f', -1, 64)
+			}
+			steps = append(steps, fmt.Sprintf("%s..%s:%+d", lower, upper, aws.ToInt32(adj.ScalingAdjustment)))
+		}
+
+		var alarms []string
+		for _, alarm := range policy.Alarms {
+			alarms = append(alarms, aws.ToString(alarm.AlarmName))
+		}
+
+		entry := fmt.Sprintf("STEP:%s[%s]", name, strings.Join(steps, ","))
+		if len(alarms) > 0 {
+			entry += "<-" + strings.Join(alarms, ",")
+		}
+		return entry
+
+	case types.PolicyTypePredictiveScaling:
+		predictive := policy.PredictiveScalingPolicyConfiguration
+		if predictive == nil {
+			return "PREDICTIVE:" + name
+		}
+
+		var metrics []string
+		for _, spec := range predictive.MetricSpecifications {
+			metric := "CUSTOM"
+			switch {
+			case spec.PredefinedMetricPairSpecification != nil:
+				metric = aws.ToString(spec.PredefinedMetricPairSpecification.PredefinedMetricType)
+			case spec.PredefinedScalingMetricSpecification != nil:
+				metric = aws.ToString(spec.PredefinedScalingMetricSpecification.PredefinedMetricType)
+			}
+			metric = strings.TrimPrefix(metric, "ECSService")
+			metrics = append(metrics, fmt.Sprintf("%s:%s", metric, strconv.FormatFloat(aws.ToFloat64(spec.TargetValue), 'f', -1, 64)))
+		}
+
+		mode := string(predictive.Mode)
+		if mode == "" {
+			mode = string(types.PredictiveScalingModeForecastOnly)
+		}
+		return fmt.Sprintf("PREDICTIVE:%s[%s](%s)", name, strings.Join(metrics, ","), mode)
+	}
+
+	// Any policy type newer than the SDK
+	return fmt.Sprintf("%s:%s", strings.ToUpper(strings.TrimSuffix(string(policy.PolicyType), "Scaling")), name)
+}
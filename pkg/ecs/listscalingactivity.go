@@ -0,0 +1,237 @@
+package ecs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/applicationautoscaling"
+	"github.com/aws/aws-sdk-go-v2/service/applicationautoscaling/types"
+	awsecs "github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/chnacib/nami/pkg/config"
+	"github.com/chnacib/nami/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+type ScalingActivity struct {
+	Time        time.Time
+	Status      string
+	OldCapacity *int32
+	NewCapacity *int32
+	Trigger     string // alarm, policy or scheduled action that caused the activity
+	Cause       string
+	Message     string
+}
+
+type ScalingSummary struct {
+	Running   int32
+	Desired   int32
+	Min       *int32
+	Max       *int32
+	Suspended string
+}
+
+var (
+	desiredCountPattern = regexp.MustCompile(`desired count to (\d+)`)
+	alarmPattern        = regexp.MustCompile(`alarm (\S+) in state`)
+	policyPattern       = regexp.MustCompile(`triggered policy (\S+)`)
+	scheduledPattern    = regexp.MustCompile(`scheduled action name (\S+)`)
+)
+
+// ListScalingActivity returns the `nami get scaling-activity` command
+func ListScalingActivity() *cobra.Command {
+	var cluster string
+	var since string
+	var notScaled bool
+
+	cmd := &cobra.Command{
+		Use:     "scaling-activity [service]",
+		Aliases: []string{"scaling-activities", "activity"},
+		Short:   "Show autoscaling activity history of a service",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			service := args[0]
+
+			window, err := utils.ParseDuration(since)
+			if err != nil {
+				return err
+			}
+
+			summary, activities, err := GetScalingActivity(cmd.Context(), cluster, service, time.Now().Add(-window), notScaled)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("%s: running %d, desired %d, min %s, max %s, suspended %s\n\n",
+				service, summary.Running, summary.Desired, formatCapacity(summary.Min), formatCapacity(summary.Max), summary.Suspended)
+
+			if len(activities) == 0 {
+				fmt.Printf("No scaling activity in the last %s\n", since)
+				return nil
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+			fmt.Fprintln(w, "TIME\tSTATUS\tCAPACITY\tTRIGGER\tCAUSE")
+
+			for _, a := range activities {
+				status := a.Status
+				if a.Message != "" && a.Status != string(types.ScalingActivityStatusCodeSuccessful) {
+					status += ": " + a.Message
+				}
+
+				fmt.Fprintf(w, "%s\t%s\t%s -> %s\t%s\t%s\n",
+					a.Time.Local().Format("2006-01-02 15:04:05"),
+					status,
+					formatCapacity(a.OldCapacity),
+					formatCapacity(a.NewCapacity),
+					a.Trigger,
+					a.Cause)
+			}
+
+			w.Flush()
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVarP(&cluster, "cluster", "c", "", "ECS Cluster name")
+	cmd.MarkFlagRequired("cluster")
+	cmd.Flags().StringVar(&since, "since", "24h", "Show activity newer than this (e.g. 2h, 24h, 7d)")
+	cmd.Flags().BoolVar(&notScaled, "not-scaled", false, "Include activities that did not change capacity")
+
+	return cmd
+}
+
+// GetScalingActivity returns the service's current scaling values and its scaling activities since the given time, newest first
+func GetScalingActivity(ctx context.Context, cluster, service string, since time.Time, notScaled bool) (ScalingSummary, []ScalingActivity, error) {
+	var summary ScalingSummary
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return summary, nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	client := applicationautoscaling.NewFromConfig(cfg.AwsConfig)
+	resourceID := fmt.Sprintf("service/%s/%s", cluster, service)
+
+	svcOut, err := awsecs.NewFromConfig(cfg.AwsConfig).DescribeServices(ctx, &awsecs.DescribeServicesInput{
+		Cluster:  aws.String(cluster),
+		Services: []string{service},
+	})
+	if err != nil {
+		return summary, nil, fmt.Errorf("describe service: %w", err)
+	}
+	if len(svcOut.Services) == 0 {
+		return summary, nil, fmt.Errorf("service %q not found in cluster %q", service, cluster)
+	}
+	summary.Running = svcOut.Services[0].RunningCount
+	summary.Desired = svcOut.Services[0].DesiredCount
+	summary.Suspended = "-"
+
+	targets, err := client.DescribeScalableTargets(ctx, &applicationautoscaling.DescribeScalableTargetsInput{
+		ServiceNamespace:  types.ServiceNamespaceEcs,
+		ScalableDimension: types.ScalableDimensionECSServiceDesiredCount,
+		ResourceIds:       []string{resourceID},
+	})
+	if err != nil {
+		return summary, nil, fmt.Errorf("describe scalable target: %w", err)
+	}
+	for _, t := range targets.ScalableTargets {
+		summary.Min = t.MinCapacity
+		summary.Max = t.MaxCapacity
+		summary.Suspended = suspendedState(t.SuspendedState)
+	}
+
+	var raw []types.ScalingActivity
+	paginator := applicationautoscaling.NewDescribeScalingActivitiesPaginator(client, &applicationautoscaling.DescribeScalingActivitiesInput{
+		ServiceNamespace:           types.ServiceNamespaceEcs,
+		ScalableDimension:          types.ScalableDimensionECSServiceDesiredCount,
+		ResourceId:                 aws.String(resourceID),
+		IncludeNotScaledActivities: aws.Bool(notScaled),
+	})
+
+	// Activities come newest first, so stop paging once they are older than the window
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return summary, nil, fmt.Errorf("describe scaling activities: %w", err)
+		}
+
+		done := false
+		for _, a := range page.ScalingActivities {
+			if aws.ToTime(a.StartTime).Before(since) {
+				done = true
+				break
+			}
+			raw = append(raw, a)
+		}
+		if done {
+			break
+		}
+	}
+
+	return summary, scalingActivities(raw), nil
+}
+
+// scalingActivities turns the raw activities (newest first) into rows, taking each activity's
+// old capacity from the activity before it
+func scalingActivities(raw []types.ScalingActivity) []ScalingActivity {
+	output := make([]ScalingActivity, 0, len(raw))
+
+	for _, a := range raw {
+		cause := aws.ToString(a.Cause)
+		activity := ScalingActivity{
+			Time:    aws.ToTime(a.StartTime),
+			Status:  string(a.StatusCode),
+			Cause:   cause,
+			Message: aws.ToString(a.StatusMessage),
+		}
+
+		if m := desiredCountPattern.FindStringSubmatch(aws.ToString(a.Description)); m != nil {
+			if v, err := strconv.Atoi(m[1]); err == nil {
+				activity.NewCapacity = aws.Int32(int32(v))
+			}
+		}
+
+		for _, reason := range a.NotScaledReasons {
+			if reason.CurrentCapacity != nil {
+				activity.OldCapacity = reason.CurrentCapacity
+				activity.NewCapacity = reason.CurrentCapacity
+			}
+			activity.Status = "NotScaled: " + aws.ToString(reason.Code)
+		}
+
+		switch {
+		case alarmPattern.MatchString(cause):
+			activity.Trigger = alarmPattern.FindStringSubmatch(cause)[1]
+			if m := policyPattern.FindStringSubmatch(cause); m != nil {
+				activity.Trigger += " -> " + m[1]
+			}
+		case scheduledPattern.MatchString(cause):
+			activity.Trigger = "schedule " + scheduledPattern.FindStringSubmatch(cause)[1]
+		default:
+			activity.Trigger = "-"
+		}
+
+		output = append(output, activity)
+	}
+
+	for i := range output {
+		if output[i].OldCapacity != nil {
+			continue
+		}
+		for j := i + 1; j < len(output); j++ {
+			if output[j].NewCapacity != nil && output[j].Status == string(types.ScalingActivityStatusCodeSuccessful) {
+				output[i].OldCapacity = output[j].NewCapacity
+				break
+			}
+		}
+	}
+
+	return output
+}
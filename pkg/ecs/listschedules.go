@@ -0,0 +1,290 @@
+package ecs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/applicationautoscaling"
+	"github.com/aws/aws-sdk-go-v2/service/applicationautoscaling/types"
+	awsecs "github.com/aws/aws-sdk-go-v2/service/ecs"
+	ectypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/aws-sdk-go-v2/service/scheduler"
+	"github.com/chnacib/nami/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+type ScheduledScaling struct {
+	Service  string
+	Name     string
+	Schedule string
+	Timezone string
+	Min      *int32
+	Max      *int32
+	Start    *time.Time
+	End      *time.Time
+}
+
+type CronJob struct {
+	Name           string
+	Group          string
+	Schedule       string
+	Timezone       string
+	State          string
+	TaskDefinition string
+	LastRun        *time.Time
+	LastStatus     string
+}
+
+// ListSchedules returns the `nami get schedules` command
+func ListSchedules() *cobra.Command {
+	var cluster string
+	var tasks bool
+
+	cmd := &cobra.Command{
+		Use:     "schedules [service]",
+		Aliases: []string{"schedule"},
+		Short:   "List scheduled scaling actions or scheduled tasks",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if tasks {
+				jobs, err := GetCronJobs(cmd.Context(), cluster)
+				if err != nil {
+					return err
+				}
+
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+				fmt.Fprintln(w, "NAME\tSCHEDULE\tTIMEZONE\tSTATE\tTASK DEFINITION\tLAST RUN\tLAST STATUS")
+
+				for _, job := range jobs {
+					name := job.Name
+					if job.Group != "default" {
+						name = job.Group + "/" + job.Name
+					}
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+						name, job.Schedule, job.Timezone, job.State, job.TaskDefinition,
+						formatOptionalTime(job.LastRun), job.LastStatus)
+				}
+
+				w.Flush()
+				return nil
+			}
+
+			service := ""
+			if len(args) > 0 {
+				service = args[0]
+			}
+
+			actions, err := GetScheduledScaling(cmd.Context(), cluster, service)
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+			fmt.Fprintln(w, "SERVICE\tNAME\tSCHEDULE\tTIMEZONE\tMIN\tMAX\tSTART\tEND")
+
+			for _, a := range actions {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+					a.Service, a.Name, a.Schedule, a.Timezone,
+					formatCapacity(a.Min), formatCapacity(a.Max),
+					formatOptionalTime(a.Start), formatOptionalTime(a.End))
+			}
+
+			w.Flush()
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVarP(&cluster, "cluster", "c", "", "ECS Cluster name")
+	cmd.MarkFlagRequired("cluster")
+	cmd.Flags().BoolVar(&tasks, "tasks", false, "List EventBridge Scheduler cronjobs that run tasks in the cluster")
+
+	return cmd
+}
+
+// GetScheduledScaling lists the scheduled actions of the services in cluster, optionally filtered by service
+func GetScheduledScaling(ctx context.Context, cluster string, service string) ([]ScheduledScaling, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	client := applicationautoscaling.NewFromConfig(cfg.AwsConfig)
+
+	input := &applicationautoscaling.DescribeScheduledActionsInput{
+		ServiceNamespace:  types.ServiceNamespaceEcs,
+		ScalableDimension: types.ScalableDimensionECSServiceDesiredCount,
+	}
+	if service != "" {
+		input.ResourceId = aws.String(fmt.Sprintf("service/%s/%s", cluster, service))
+	}
+
+	prefix := fmt.Sprintf("service/%s/", cluster)
+	var output []ScheduledScaling
+
+	paginator := applicationautoscaling.NewDescribeScheduledActionsPaginator(client, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("describe scheduled actions: %w", err)
+		}
+
+		for _, action := range page.ScheduledActions {
+			resourceID := aws.ToString(action.ResourceId)
+			if !strings.HasPrefix(resourceID, prefix) {
+				continue
+			}
+
+			a := ScheduledScaling{
+				Service:  strings.TrimPrefix(resourceID, prefix),
+				Name:     aws.ToString(action.ScheduledActionName),
+				Schedule: aws.ToString(action.Schedule),
+				Timezone: aws.ToString(action.Timezone),
+				Start:    action.StartTime,
+				End:      action.EndTime,
+			}
+			if a.Timezone == "" {
+				a.Timezone = "UTC"
+			}
+			if action.ScalableTargetAction != nil {
+				a.Min = action.ScalableTargetAction.MinCapacity
+				a.Max = action.ScalableTargetAction.MaxCapacity
+			}
+
+			output = append(output, a)
+		}
+	}
+
+	sort.Slice(output, func(i, j int) bool {
+		if output[i].Service != output[j].Service {
+			return output[i].Service < output[j].Service
+		}
+		return output[i].Name < output[j].Name
+	})
+
+	return output, nil
+}
+
+// GetCronJobs lists the EventBridge Scheduler schedules that run tasks in cluster, with the status of their
+// most recent run as recorded in the cronjob history log group
+func GetCronJobs(ctx context.Context, cluster string) ([]CronJob, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	// -c takes a cluster name or ARN, schedules always target the ARN
+	clusters, err := awsecs.NewFromConfig(cfg.AwsConfig).DescribeClusters(ctx, &awsecs.DescribeClustersInput{Clusters: []string{cluster}})
+	if err != nil {
+		return nil, fmt.Errorf("describe cluster: %w", err)
+	}
+	if len(clusters.Clusters) == 0 {
+		return nil, fmt.Errorf("cluster %q not found", cluster)
+	}
+	clusterArn := aws.ToString(clusters.Clusters[0].ClusterArn)
+
+	client := scheduler.NewFromConfig(cfg.AwsConfig)
+
+	var jobs []CronJob
+	taskGroups := make(map[string][]int) // ECS task group -> jobs
+
+	paginator := scheduler.NewListSchedulesPaginator(client, &scheduler.ListSchedulesInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("list schedules: %w", err)
+		}
+
+		for _, summary := range page.Schedules {
+			if summary.Target == nil || aws.ToString(summary.Target.Arn) != clusterArn {
+				continue
+			}
+
+			schedule, err := getCronJob(ctx, client, aws.ToString(summary.Name), aws.ToString(summary.GroupName))
+			if err != nil {
+				return nil, err
+			}
+
+			params := schedule.Target.EcsParameters
+			job := CronJob{
+				Name:           aws.ToString(schedule.Name),
+				Group:          aws.ToString(schedule.GroupName),
+				Schedule:       aws.ToString(schedule.ScheduleExpression),
+				Timezone:       aws.ToString(schedule.ScheduleExpressionTimezone),
+				State:          string(schedule.State),
+				TaskDefinition: NameArn(aws.ToString(params.TaskDefinitionArn)),
+				LastStatus:     fmt.Sprintf("no run in the last %d days", cronJobHistoryRetention),
+			}
+			if job.Timezone == "" {
+				job.Timezone = "UTC"
+			}
+
+			taskGroups[aws.ToString(params.Group)] = append(taskGroups[aws.ToString(params.Group)], len(jobs))
+			jobs = append(jobs, job)
+		}
+	}
+
+	if len(jobs) > 0 {
+		runs, err := cronJobHistory(ctx, cfg.AwsConfig, clusterArn)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: cronjob history unavailable, recreate a cronjob to set it up: %v\n", err)
+			for i := range jobs {
+				jobs[i].LastStatus = "-"
+			}
+		}
+
+		for group, task := range runs {
+			for _, i := range taskGroups[group] {
+				jobs[i].LastRun = task.CreatedAt
+				jobs[i].LastStatus = cronJobStatus(task)
+			}
+		}
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		if jobs[i].Group != jobs[j].Group {
+			return jobs[i].Group < jobs[j].Group
+		}
+		return jobs[i].Name < jobs[j].Name
+	})
+
+	return jobs, nil
+}
+
+// cronJobStatus summarizes how a cronjob task ended, or its status while it is still running
+func cronJobStatus(task ectypes.Task) string {
+	status := aws.ToString(task.LastStatus)
+	if status != "STOPPED" {
+		return status
+	}
+
+	for _, c := range task.Containers {
+		if c.ExitCode != nil && *c.ExitCode != 0 {
+			return fmt.Sprintf("Failed (%s exit %d)", aws.ToString(c.Name), *c.ExitCode)
+		}
+	}
+	if task.StopCode == ectypes.TaskStopCodeEssentialContainerExited {
+		return "Succeeded"
+	}
+
+	return "Failed: " + aws.ToString(task.StoppedReason)
+}
+
+func formatCapacity(v *int32) string {
+	if v == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%d", *v)
+}
+
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
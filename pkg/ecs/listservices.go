@@ -4,12 +4,13 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"sync"
+	"strings"
 	"text/tabwriter"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ectypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
 	"github.com/chnacib/nami/pkg/config"
 	"github.com/chnacib/nami/pkg/cw"
 	"github.com/chnacib/nami/pkg/utils"
@@ -32,16 +33,22 @@ type ListServicesOutput struct {
 	CreatedAt          *time.Time
 	TaskDefinition     string
 	TaskDefinitionName string
+	LoadBalancers      []ectypes.LoadBalancer
+	Deployments        []ectypes.Deployment
 }
 
 // ListServices creates a cobra command for listing ECS services
 func ListServices() *cobra.Command {
-	var cluster string
+	var (
+		cluster string
+		window  time.Duration
+		stat    string
+	)
 	cmd := &cobra.Command{
 		Use:     "services",
 		Aliases: []string{"svc", "service"},
 		Short:   "list ECS services",
-		Run: func(cmd *cobra.Command, args []string) {
+		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := context.Background()
 			options := ServiceOptions{
 				Cluster: cluster,
@@ -52,77 +59,46 @@ func ListServices() *cobra.Command {
 				options.Service = args[0]
 			}
 
+			metrics := cw.MetricsOptions{Window: window}
+			var err error
+			if metrics.Stat, err = cw.ParseStat(stat); err != nil {
+				return err
+			}
+
 			services, err := GetECSServices(ctx, options)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			}
 
-			// Display the results in a table
-			w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
-			fmt.Fprintln(w, "NAME\tTASK DEFINITION\tRUNNING\tCPU\tMEMORY\tLAUNCH")
-
-			// Process services and collect CloudWatch metrics in parallel
-			utilizationCh := make(chan struct {
-				Service string
-				CPU     float64
-				Memory  float64
-			}, len(services))
-
-			var wg sync.WaitGroup
-			for _, service := range services {
-				wg.Add(1)
-				go func(svc ListServicesOutput) {
-					defer wg.Done()
-
-					// Get CloudWatch metrics
-					cpu := cw.CpuAverage(svc.Cluster, svc.Service)
-					memory := cw.MemoryAverage(svc.Cluster, svc.Service)
-
-					utilizationCh <- struct {
-						Service string
-						CPU     float64
-						Memory  float64
-					}{
-						Service: svc.Service,
-						CPU:     cpu,
-						Memory:  memory,
-					}
-				}(service)
+			cfg, err := config.LoadConfig()
+			if err != nil {
+				return fmt.Errorf("failed to load configuration: %w", err)
 			}
 
-			// Wait for all goroutines to complete
-			go func() {
-				wg.Wait()
-				close(utilizationCh)
-			}()
-
-			// Build a map of utilization data
-			utilMap := make(map[string]struct {
-				CPU    float64
-				Memory float64
-			})
+			keys := make([]cw.ServiceKey, len(services))
+			for i, service := range services {
+				keys[i] = cw.ServiceKey{Cluster: service.Cluster, Service: service.Service}
+			}
 
-			for util := range utilizationCh {
-				utilMap[util.Service] = struct {
-					CPU    float64
-					Memory float64
-				}{
-					CPU:    util.CPU,
-					Memory: util.Memory,
-				}
+			// CPU and memory of every service in as few GetMetricData calls as possible
+			utilization, err := cw.GetServiceUtilization(ctx, cfg.AwsConfig, keys, metrics)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
 			}
 
-			// Print service information with utilization data
+			// Display the results in a table
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+			label := strings.ToUpper(metrics.Label())
+			fmt.Fprintf(w, "NAME\tTASK DEFINITION\tRUNNING\tCPU (%s)\tMEMORY (%s)\tLAUNCH\n", label, label)
+
 			for _, service := range services {
-				util, ok := utilMap[service.Service]
-				cpuUtil := 0.0
-				memUtil := 0.0
-				if ok {
-					cpuUtil = util.CPU
-					memUtil = util.Memory
+				cpuUtil, memUtil := "-", "-"
+				if util := utilization[cw.ServiceKey{Cluster: service.Cluster, Service: service.Service}]; util.HasData {
+					cpuUtil = fmt.Sprintf("%.2f%%", util.CPU)
+					memUtil = fmt.Sprintf("%.2f%%", util.Memory)
 				}
 
-				fmt.Fprintf(w, "%s\t%s\t%d/%d\t%.2f%%\t%.2f%%\t%s\n",
+				fmt.Fprintf(w, "%s\t%s\t%d/%d\t%s\t%s\t%s\n",
 					service.Service,
 					service.TaskDefinitionName,
 					service.RunningCount,
@@ -133,11 +109,15 @@ func ListServices() *cobra.Command {
 			}
 
 			w.Flush()
+			return nil
 		},
+		SilenceUsage: true,
 	}
 
 	cmd.Flags().StringVarP(&cluster, "cluster", "c", "", "ECS Cluster name")
 	cmd.MarkFlagRequired("cluster")
+	cmd.Flags().DurationVar(&window, "metrics-window", 0, "Compute CPU and memory over this window, e.g. 15m (default the latest datapoint)")
+	cmd.Flags().StringVar(&stat, "stat", "avg", "Statistic for CPU and memory: avg, min, max or a percentile such as p95")
 	return cmd
 }
 
@@ -240,6 +220,8 @@ func GetECSServices(ctx context.Context, options ServiceOptions) ([]ListServices
 					CreatedAt:          service.CreatedAt,
 					TaskDefinition:     aws.ToString(service.TaskDefinition),
 					TaskDefinitionName: taskDefName,
+					LoadBalancers:      service.LoadBalancers,
+					Deployments:        service.Deployments,
 				}
 
 				if service.LaunchType != "" {
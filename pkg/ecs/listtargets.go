@@ -0,0 +1,233 @@
+package ecs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsecs "github.com/aws/aws-sdk-go-v2/service/ecs"
+	ectypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
+	elbtypes "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2/types"
+	"github.com/chnacib/nami/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+// ServiceTarget is a target group target with the ECS task behind it
+type ServiceTarget struct {
+	ID               string // IP address or EC2 instance ID
+	Port             int32
+	AvailabilityZone string
+	State            string
+	Reason           string
+	Description      string
+	TaskID           string // empty when no task of the service matches the target
+	TaskStatus       string
+}
+
+type ServiceTargetGroup struct {
+	TargetGroup   elbtypes.TargetGroup
+	ContainerName string
+	ContainerPort int32
+	Targets       []ServiceTarget
+}
+
+// ListTargets returns the `nami get targets` command
+func ListTargets() *cobra.Command {
+	var cluster string
+
+	cmd := &cobra.Command{
+		Use:     "targets [service]",
+		Aliases: []string{"target"},
+		Short:   "Show the load balancer target health of a service's tasks",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, groups, err := GetServiceTargets(cmd.Context(), cluster, args[0])
+			if err != nil {
+				return err
+			}
+
+			if svc.HealthCheckGracePeriodSeconds != nil {
+				fmt.Printf("Health check grace period: %ds\n\n", aws.ToInt32(svc.HealthCheckGracePeriodSeconds))
+			}
+			for _, group := range groups {
+				printTargetGroup(group)
+			}
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVarP(&cluster, "cluster", "c", "", "ECS Cluster name")
+	cmd.MarkFlagRequired("cluster")
+
+	return cmd
+}
+
+// GetServiceTargets returns the target groups of the service with the health of each target, mapped back to
+// the service's running and recently stopped tasks
+func GetServiceTargets(ctx context.Context, cluster, service string) (*ectypes.Service, []ServiceTargetGroup, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	client := awsecs.NewFromConfig(cfg.AwsConfig)
+	elb := elasticloadbalancingv2.NewFromConfig(cfg.AwsConfig)
+
+	svc, err := describeService(ctx, client, cluster, service)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var arns []string
+	for _, lb := range svc.LoadBalancers {
+		if lb.TargetGroupArn != nil {
+			arns = append(arns, aws.ToString(lb.TargetGroupArn))
+		}
+	}
+	if len(arns) == 0 {
+		return nil, nil, fmt.Errorf("service %q has no load balancer target group", service)
+	}
+
+	out, err := elb.DescribeTargetGroups(ctx, &elasticloadbalancingv2.DescribeTargetGroupsInput{TargetGroupArns: arns})
+	if err != nil {
+		return nil, nil, fmt.Errorf("describe target groups: %w", err)
+	}
+	targetGroups := make(map[string]elbtypes.TargetGroup)
+	for _, tg := range out.TargetGroups {
+		targetGroups[aws.ToString(tg.TargetGroupArn)] = tg
+	}
+
+	// Draining targets belong to tasks that are already stopping
+	var tasks []ectypes.Task
+	for _, status := range []ectypes.DesiredStatus{ectypes.DesiredStatusRunning, ectypes.DesiredStatusStopped} {
+		found, err := serviceTasks(ctx, client, cluster, service, status)
+		if err != nil {
+			return nil, nil, err
+		}
+		tasks = append(tasks, found...)
+	}
+
+	instances, err := containerInstanceIDs(ctx, client, cluster, tasks)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var groups []ServiceTargetGroup
+	for _, lb := range svc.LoadBalancers {
+		tg, ok := targetGroups[aws.ToString(lb.TargetGroupArn)]
+		if !ok {
+			continue
+		}
+
+		group := ServiceTargetGroup{
+			TargetGroup:   tg,
+			ContainerName: aws.ToString(lb.ContainerName),
+			ContainerPort: aws.ToInt32(lb.ContainerPort),
+		}
+
+		// A stopped task can have held the same IP and port as a running one, the running task wins
+		owners := make(map[string]ectypes.Task) // by target id:port
+		for _, task := range tasks {
+			target := taskTarget(task, group.ContainerName, group.ContainerPort, instances)
+			if target == nil || target.Id == nil {
+				continue
+			}
+			key := fmt.Sprintf("%s:%d", aws.ToString(target.Id), aws.ToInt32(target.Port))
+			if owner, ok := owners[key]; ok && aws.ToString(owner.LastStatus) == "RUNNING" {
+				continue
+			}
+			owners[key] = task
+		}
+
+		health, err := elb.DescribeTargetHealth(ctx, &elasticloadbalancingv2.DescribeTargetHealthInput{TargetGroupArn: tg.TargetGroupArn})
+		if err != nil {
+			return nil, nil, fmt.Errorf("describe target health: %w", err)
+		}
+
+		for _, d := range health.TargetHealthDescriptions {
+			if d.Target == nil {
+				continue
+			}
+
+			t := ServiceTarget{
+				ID:               aws.ToString(d.Target.Id),
+				Port:             aws.ToInt32(d.Target.Port),
+				AvailabilityZone: aws.ToString(d.Target.AvailabilityZone),
+			}
+			if d.TargetHealth != nil {
+				t.State = string(d.TargetHealth.State)
+				t.Reason = string(d.TargetHealth.Reason)
+				t.Description = aws.ToString(d.TargetHealth.Description)
+			}
+			if task, ok := owners[fmt.Sprintf("%s:%d", t.ID, t.Port)]; ok {
+				t.TaskID = NameArn(aws.ToString(task.TaskArn))
+				t.TaskStatus = aws.ToString(task.LastStatus)
+			}
+
+			group.Targets = append(group.Targets, t)
+		}
+
+		sort.Slice(group.Targets, func(i, j int) bool {
+			if group.Targets[i].ID != group.Targets[j].ID {
+				return group.Targets[i].ID < group.Targets[j].ID
+			}
+			return group.Targets[i].Port < group.Targets[j].Port
+		})
+
+		groups = append(groups, group)
+	}
+
+	return svc, groups, nil
+}
+
+func printTargetGroup(group ServiceTargetGroup) {
+	tg := group.TargetGroup
+
+	fmt.Printf("Target group: %s (%s:%d, %s targets, container %s:%d)\n", aws.ToString(tg.TargetGroupName),
+		tg.Protocol, aws.ToInt32(tg.Port), tg.TargetType, group.ContainerName, group.ContainerPort)
+
+	check := fmt.Sprintf("%s port %s", tg.HealthCheckProtocol, aws.ToString(tg.HealthCheckPort))
+	if tg.HealthCheckPath != nil {
+		check += " path " + aws.ToString(tg.HealthCheckPath)
+	}
+	if tg.Matcher != nil {
+		switch {
+		case tg.Matcher.HttpCode != nil:
+			check += ", expects " + aws.ToString(tg.Matcher.HttpCode)
+		case tg.Matcher.GrpcCode != nil:
+			check += ", expects gRPC " + aws.ToString(tg.Matcher.GrpcCode)
+		}
+	}
+	fmt.Printf("Health check: %s, every %ds, timeout %ds, healthy after %d, unhealthy after %d\n\n", check,
+		aws.ToInt32(tg.HealthCheckIntervalSeconds), aws.ToInt32(tg.HealthCheckTimeoutSeconds),
+		aws.ToInt32(tg.HealthyThresholdCount), aws.ToInt32(tg.UnhealthyThresholdCount))
+
+	if len(group.Targets) == 0 {
+		fmt.Print("No targets registered\n\n")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "TARGET\tPORT\tAZ\tTASK\tTASK STATUS\tSTATE\tREASON\tDESCRIPTION")
+
+	counts := make(map[string]int)
+	for _, t := range group.Targets {
+		counts[t.State]++
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\n", t.ID, t.Port, valueOrDash(t.AvailabilityZone),
+			valueOrDash(t.TaskID), valueOrDash(t.TaskStatus), t.State, valueOrDash(t.Reason), valueOrDash(t.Description))
+	}
+	w.Flush()
+
+	var states []string
+	for state, n := range counts {
+		states = append(states, fmt.Sprintf("%d %s", n, state))
+	}
+	sort.Strings(states)
+	fmt.Printf("\n%s\n\n", strings.Join(states, ", "))
+}
@@ -1,92 +1,197 @@
 package ecs
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"sort"
 	"text/tabwriter"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsecs "github.com/aws/aws-sdk-go-v2/service/ecs"
+	ectypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/chnacib/nami/pkg/config"
+	"github.com/chnacib/nami/pkg/cw"
 	"github.com/spf13/cobra"
 )
 
 //Tasks
 
 func ListTasks() *cobra.Command {
-	var cluster string
-	var taskArns []*string
-	var timeStart time.Time
-	var formatTime string
-	var network string
+	var (
+		cluster string
+		metrics bool
+		window  time.Duration
+	)
 
 	cmd := &cobra.Command{
-		Use:     "tasks",
+		Use:     "tasks [service]",
 		Aliases: []string{"tsk", "task"},
-		Short:   "List ECS tasks from services",
-		Run: func(cmd *cobra.Command, args []string) {
-			sess := session.Must(session.NewSessionWithOptions(session.Options{
-				SharedConfigState: session.SharedConfigEnable,
-			}))
-			client := ecs.New(sess)
-			if len(args) == 0 {
-				listTaskInput := &ecs.ListTasksInput{
-					Cluster: aws.String(cluster),
-				}
+		Short:   "List ECS tasks of a cluster or service",
+		Args:    cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			cfg, err := config.LoadConfig()
+			if err != nil {
+				return fmt.Errorf("failed to load configuration: %w", err)
+			}
 
-				listTaskOutput, err := client.ListTasks(listTaskInput)
-				if err != nil {
-					fmt.Printf("Tasks not found for cluster %s", cluster)
-					os.Exit(0)
-				}
+			client := awsecs.NewFromConfig(cfg.AwsConfig)
+
+			var tasks []ectypes.Task
+			if len(args) > 0 {
+				tasks, err = serviceTasks(ctx, client, cluster, args[0], ectypes.DesiredStatusRunning)
+			} else {
+				tasks, err = clusterTasks(ctx, client, cluster)
+			}
+			if err != nil {
+				return err
+			}
+			if len(tasks) == 0 {
+				fmt.Printf("No tasks found in cluster %s\n", cluster)
+				return nil
+			}
 
-				taskArns = append(taskArns, listTaskOutput.TaskArns...)
+			sort.Slice(tasks, func(i, j int) bool { return aws.ToString(tasks[i].TaskArn) < aws.ToString(tasks[j].TaskArn) })
 
-				describeTasksInput := &ecs.DescribeTasksInput{
-					Tasks:   taskArns,
-					Cluster: aws.String(cluster),
+			var usage map[string]*cw.TaskMetrics
+			if metrics {
+				var ids []string
+				if len(args) > 0 {
+					for _, task := range tasks {
+						ids = append(ids, NameArn(aws.ToString(task.TaskArn)))
+					}
 				}
-
-				describeTasksOutput, err := client.DescribeTasks(describeTasksInput)
-				if err != nil {
-					fmt.Printf("Tasks not found for cluster %s\n", cluster)
-					os.Exit(0)
+				if usage, err = cw.GetTaskMetrics(ctx, cfg.AwsConfig, cluster, ids, window); err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: task metrics unavailable: %v\n", err)
 				}
+			}
 
-				w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+			header := "NAME\tREVISION\tSTATUS\tCPU\tMEMORY\tNETWORK\tSTARTED"
+			if metrics {
+				header += "\tCPU USED\tMEMORY USED\tMEMORY CHANGE\tNET RX/TX"
+			}
+			fmt.Fprintln(w, header)
 
-				fmt.Fprintln(w, "NAME\tREVISION\tSTATUS\tCPU\tMEMORY\tNETWORK\tSTARTED")
+			for _, task := range tasks {
+				id := NameArn(aws.ToString(task.TaskArn))
 
-				for _, task := range describeTasksOutput.Tasks {
+				started := "-"
+				if task.StartedAt != nil {
+					started = task.StartedAt.Format("2006-01-02 15:04:05")
+				}
 
-					taskName := NameArn(aws.StringValue(task.TaskArn))
-					revision := NameArn(aws.StringValue(task.TaskDefinitionArn))
-					cpu := aws.StringValue(task.Cpu)
-					memory := aws.StringValue(task.Memory)
-					status := aws.StringValue(task.LastStatus)
-					if len(task.Containers) > 0 {
-						network = aws.StringValue(task.Containers[0].NetworkInterfaces[0].PrivateIpv4Address)
-					} else {
-						network = "-"
-					}
-					if task.StartedAt != nil {
-						timeStart = aws.TimeValue(task.StartedAt)
-						formatTime = timeStart.Format("2006-01-02 15:04:05")
-					} else {
-						formatTime = "-"
-					}
+				row := fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%s\t%s", id, NameArn(aws.ToString(task.TaskDefinitionArn)),
+					aws.ToString(task.LastStatus), valueOrDash(aws.ToString(task.Cpu)), valueOrDash(aws.ToString(task.Memory)),
+					valueOrDash(taskPrivateIP(task)), started)
 
-					fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", taskName, revision, status, cpu, memory, network, formatTime)
+				if metrics {
+					m := cw.EmptyMetrics()
+					if u := usage[id]; u != nil {
+						m = u.ResourceMetrics
+					}
+					row += fmt.Sprintf("\t%s\t%s\t%s\t%s/%s", formatPercent(m.CPUPercent()),
+						formatMemory(m.MemoryUtilized, m.MemoryPercent()), formatMemoryChange(m.MemoryFirst, m.MemoryLast),
+						formatRate(m.NetworkRx), formatRate(m.NetworkTx))
 				}
-				w.Flush()
-				os.Exit(0)
+
+				fmt.Fprintln(w, row)
 			}
+
+			w.Flush()
+			return nil
 		},
+		SilenceUsage: true,
 	}
 
-	cmd.Flags().StringVarP(&cluster, "cluster", "c", "string", "ECS Cluster name")
+	cmd.Flags().StringVarP(&cluster, "cluster", "c", "", "ECS Cluster name")
 	cmd.MarkFlagRequired("cluster")
+	cmd.Flags().BoolVar(&metrics, "metrics", false, "Show CPU, memory and network usage from Container Insights")
+	cmd.Flags().DurationVar(&window, "window", 5*time.Minute, "Window the usage is averaged over")
 
 	return cmd
 }
+
+// clusterTasks describes every task of the cluster that is running or about to
+func clusterTasks(ctx context.Context, client *awsecs.Client, cluster string) ([]ectypes.Task, error) {
+	return listTasks(ctx, client, &awsecs.ListTasksInput{Cluster: aws.String(cluster)})
+}
+
+// serviceTasks describes the tasks of the service with the given desired status
+func serviceTasks(ctx context.Context, client *awsecs.Client, cluster, service string, status ectypes.DesiredStatus) ([]ectypes.Task, error) {
+	return listTasks(ctx, client, &awsecs.ListTasksInput{
+		Cluster:       aws.String(cluster),
+		ServiceName:   aws.String(service),
+		DesiredStatus: status,
+	})
+}
+
+func listTasks(ctx context.Context, client *awsecs.Client, input *awsecs.ListTasksInput) ([]ectypes.Task, error) {
+	var arns []string
+	paginator := awsecs.NewListTasksPaginator(client, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("list tasks: %w", err)
+		}
+		arns = append(arns, page.TaskArns...)
+	}
+
+	// Stopped tasks expire, a listed task can be gone by the time it is described
+	tasks, _, err := describeTaskBatches(ctx, client, aws.ToString(input.Cluster), arns)
+	return tasks, err
+}
+
+// describeTasks describes tasks by ID or ARN, failing on tasks that cannot be found
+func describeTasks(ctx context.Context, client *awsecs.Client, cluster string, arns []string) ([]ectypes.Task, error) {
+	tasks, failures, err := describeTaskBatches(ctx, client, cluster, arns)
+	if err != nil {
+		return nil, err
+	}
+	for _, failure := range failures {
+		return nil, fmt.Errorf("task %s: %s", NameArn(aws.ToString(failure.Arn)), aws.ToString(failure.Reason))
+	}
+	return tasks, nil
+}
+
+// describeTaskBatches describes the tasks 100 at a time and returns the tasks that could not be described
+func describeTaskBatches(ctx context.Context, client *awsecs.Client, cluster string, arns []string) ([]ectypes.Task, []ectypes.Failure, error) {
+	var tasks []ectypes.Task
+	var failures []ectypes.Failure
+	for start := 0; start < len(arns); start += 100 {
+		end := min(start+100, len(arns))
+		out, err := client.DescribeTasks(ctx, &awsecs.DescribeTasksInput{
+			Cluster: aws.String(cluster),
+			Tasks:   arns[start:end],
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("describe tasks: %w", err)
+		}
+		tasks = append(tasks, out.Tasks...)
+		failures = append(failures, out.Failures...)
+	}
+
+	return tasks, failures, nil
+}
+
+// taskPrivateIP returns the task ENI address (awsvpc) or the first container's address
+func taskPrivateIP(task ectypes.Task) string {
+	for _, attachment := range task.Attachments {
+		for _, detail := range attachment.Details {
+			if aws.ToString(detail.Name) == "privateIPv4Address" {
+				return aws.ToString(detail.Value)
+			}
+		}
+	}
+	for _, c := range task.Containers {
+		for _, ni := range c.NetworkInterfaces {
+			if ni.PrivateIpv4Address != nil {
+				return aws.ToString(ni.PrivateIpv4Address)
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,281 @@
+package ecs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/smithy-go"
+	"github.com/chnacib/nami/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+// NodeVersion compares a node's AMI and agent with the recommended ECS-optimized AMI of its OS variant
+type NodeVersion struct {
+	Node             NodeOutput
+	AmiName          string
+	Parameter        string // public SSM parameter the node was compared with
+	CustomAmi        bool   // not an ECS-optimized AMI, only the agent version is compared
+	UnknownAmi       bool   // the AMI was deregistered, only the agent version is compared
+	RecommendedAmi   string
+	RecommendedAgent string
+	AmiOutdated      bool
+	AgentOutdated    bool
+}
+
+func (n NodeVersion) Outdated() bool {
+	return n.AmiOutdated || n.AgentOutdated
+}
+
+// recommendedAmi is the JSON value of the .../recommended SSM parameters
+type recommendedAmi struct {
+	ImageID         string `json:"image_id"`
+	ImageName       string `json:"image_name"`
+	EcsAgentVersion string `json:"ecs_agent_version"`
+}
+
+// OutdatedNodes returns the `nami nodes outdated` command
+func OutdatedNodes() *cobra.Command {
+	var cluster string
+
+	cmd := &cobra.Command{
+		Use:   "outdated",
+		Short: "Compare container instance AMIs and agents with the recommended ECS-optimized AMI",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			nodes, err := GetNodeVersions(cmd.Context(), cluster)
+			if err != nil {
+				return err
+			}
+			if len(nodes) == 0 {
+				return printNoNodes(cmd.Context(), cluster)
+			}
+
+			printNodeVersions(nodes)
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVarP(&cluster, "cluster", "c", "", "ECS Cluster name")
+	cmd.MarkFlagRequired("cluster")
+
+	return cmd
+}
+
+// GetNodeVersions returns the nodes of the cluster with the recommended AMI and agent version for each
+func GetNodeVersions(ctx context.Context, cluster string) ([]NodeVersion, error) {
+	nodes, err := GetNodes(ctx, cluster)
+	if err != nil {
+		return nil, err
+	}
+	if len(nodes) == 0 {
+		return nil, nil
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	// AMI names tell which ECS-optimized variant (AL2023, AL2, GPU, ...) each node runs
+	var amis []string
+	seen := make(map[string]bool)
+	for _, n := range nodes {
+		if n.AmiID != "" && !seen[n.AmiID] {
+			amis = append(amis, n.AmiID)
+			seen[n.AmiID] = true
+		}
+	}
+
+	names, err := imageNames(ctx, ec2.NewFromConfig(cfg.AwsConfig), amis)
+	if err != nil {
+		return nil, err
+	}
+
+	client := ssm.NewFromConfig(cfg.AwsConfig)
+	recommended := make(map[string]recommendedAmi)
+
+	output := make([]NodeVersion, len(nodes))
+	for i, n := range nodes {
+		name, known := names[n.AmiID]
+		v := NodeVersion{Node: n, AmiName: name, UnknownAmi: n.AmiID != "" && !known}
+
+		var arch string
+		for _, attr := range n.Instance.Attributes {
+			if aws.ToString(attr.Name) == "ecs.cpu-architecture" {
+				arch = aws.ToString(attr.Value)
+			}
+		}
+
+		v.Parameter = amiParameter(v.AmiName, arch)
+		if v.Parameter == "" {
+			v.CustomAmi = !v.UnknownAmi
+			v.Parameter = amiParameter("al2023-ami-ecs-hvm", arch)
+		}
+
+		r, ok := recommended[v.Parameter]
+		if !ok {
+			out, err := client.GetParameter(ctx, &ssm.GetParameterInput{Name: aws.String(v.Parameter)})
+			if err != nil {
+				return nil, fmt.Errorf("get parameter %s: %w", v.Parameter, err)
+			}
+			if err := json.Unmarshal([]byte(aws.ToString(out.Parameter.Value)), &r); err != nil {
+				return nil, fmt.Errorf("parse parameter %s: %w", v.Parameter, err)
+			}
+			recommended[v.Parameter] = r
+		}
+
+		v.RecommendedAmi = r.ImageID
+		v.RecommendedAgent = r.EcsAgentVersion
+		v.AmiOutdated = !v.CustomAmi && !v.UnknownAmi && n.AmiID != r.ImageID
+		v.AgentOutdated = compareVersions(n.AgentVersion, r.EcsAgentVersion) < 0
+
+		output[i] = v
+	}
+
+	return output, nil
+}
+
+// imageNames returns the names of the AMIs. Deregistered AMIs make DescribeImages fail for the whole
+// request, so the images are then described one by one and the missing ones left out.
+func imageNames(ctx context.Context, client *ec2.Client, amis []string) (map[string]string, error) {
+	names := make(map[string]string)
+	if len(amis) == 0 {
+		return names, nil
+	}
+
+	out, err := client.DescribeImages(ctx, &ec2.DescribeImagesInput{ImageIds: amis})
+	if err == nil {
+		for _, image := range out.Images {
+			names[aws.ToString(image.ImageId)] = aws.ToString(image.Name)
+		}
+		return names, nil
+	}
+	if !amiNotFound(err) {
+		return nil, fmt.Errorf("describe images: %w", err)
+	}
+
+	for _, ami := range amis {
+		out, err := client.DescribeImages(ctx, &ec2.DescribeImagesInput{ImageIds: []string{ami}})
+		if amiNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("describe image %s: %w", ami, err)
+		}
+		for _, image := range out.Images {
+			names[aws.ToString(image.ImageId)] = aws.ToString(image.Name)
+		}
+	}
+
+	return names, nil
+}
+
+func amiNotFound(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "InvalidAMIID.NotFound"
+}
+
+// amiParameter returns the public SSM parameter with the recommended AMI for the ECS-optimized variant
+// of the image name, or "" when the image is not an ECS-optimized AMI
+func amiParameter(imageName, arch string) string {
+	const prefix = "/aws/service/ecs/optimized-ami/"
+
+	suffix := "/recommended"
+	if arch == "arm64" {
+		suffix = "/arm64/recommended"
+	}
+
+	switch {
+	case strings.HasPrefix(imageName, "al2023-ami-ecs-neuron"):
+		return prefix + "amazon-linux-2023/neuron/recommended"
+	case strings.HasPrefix(imageName, "al2023-ami-ecs-gpu"):
+		return prefix + "amazon-linux-2023/gpu/recommended"
+	case strings.HasPrefix(imageName, "al2023-ami-ecs"):
+		return prefix + "amazon-linux-2023" + suffix
+	case strings.HasPrefix(imageName, "amzn2-ami-ecs-gpu"):
+		return prefix + "amazon-linux-2/gpu/recommended"
+	case strings.HasPrefix(imageName, "amzn2-ami-ecs-inf"):
+		return prefix + "amazon-linux-2/inf/recommended"
+	case strings.HasPrefix(imageName, "amzn2-ami-ecs-kernel-5.10"):
+		return prefix + "amazon-linux-2/kernel-5.10" + suffix
+	case strings.HasPrefix(imageName, "amzn2-ami-ecs"):
+		return prefix + "amazon-linux-2" + suffix
+	case strings.HasPrefix(imageName, "amzn-ami-") && strings.Contains(imageName, "amazon-ecs-optimized"):
+		return prefix + "amazon-linux/recommended"
+	}
+	return ""
+}
+
+// compareVersions compares dotted versions such as 1.89.2, returning -1, 0 or 1. Empty versions are
+// treated as equal so nodes without version info are not reported.
+func compareVersions(a, b string) int {
+	if a == "" || b == "" {
+		return 0
+	}
+
+	pa, pb := strings.Split(strings.TrimPrefix(a, "v"), "."), strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < max(len(pa), len(pb)); i++ {
+		var x, y int
+		if i < len(pa) {
+			x, _ = strconv.Atoi(pa[i])
+		}
+		if i < len(pb) {
+			y, _ = strconv.Atoi(pb[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func printNodeVersions(nodes []NodeVersion) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "ID\tINSTANCE\tAMI\tRECOMMENDED AMI\tAGENT\tRECOMMENDED AGENT\tSTATUS")
+
+	outdated := 0
+	for _, n := range nodes {
+		var status []string
+		if n.AmiOutdated {
+			status = append(status, "AMI outdated")
+		}
+		if n.AgentOutdated {
+			status = append(status, "agent outdated")
+		}
+		if n.CustomAmi {
+			status = append(status, "custom AMI")
+		}
+		if n.UnknownAmi {
+			status = append(status, "unknown AMI")
+		}
+		if !n.Outdated() {
+			status = append([]string{"up to date"}, status...)
+		} else {
+			outdated++
+		}
+
+		recommendedAmi := n.RecommendedAmi
+		if n.CustomAmi || n.UnknownAmi {
+			recommendedAmi = "-"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			n.Node.ID, n.Node.Ec2InstanceID, valueOrDash(n.Node.AmiID), recommendedAmi,
+			valueOrDash(n.Node.AgentVersion), valueOrDash(n.RecommendedAgent), strings.Join(status, ", "))
+	}
+	w.Flush()
+
+	fmt.Printf("\n%d of %d nodes outdated\n", outdated, len(nodes))
+}
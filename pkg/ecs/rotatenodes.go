@@ -0,0 +1,362 @@
+package ecs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	astypes "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+	awsecs "github.com/aws/aws-sdk-go-v2/service/ecs"
+	ectypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/chnacib/nami/pkg/config"
+	"github.com/chnacib/nami/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+type RotateNodesOptions struct {
+	Cluster         string
+	All             bool // rotate every node, not only the outdated ones
+	InstanceRefresh bool // start an Auto Scaling instance refresh instead of replacing nodes one by one
+	Force           bool // terminate nodes that still run standalone tasks, which draining does not move
+	Yes             bool
+	Timeout         time.Duration // per node
+}
+
+// RotateNodes returns the `nami nodes rotate` command
+func RotateNodes() *cobra.Command {
+	var opts RotateNodesOptions
+	var timeoutSec int
+
+	cmd := &cobra.Command{
+		Use:   "rotate",
+		Short: "Replace outdated container instances one at a time",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.Timeout = time.Duration(timeoutSec) * time.Second
+			return rotateNodes(cmd.Context(), opts)
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVarP(&opts.Cluster, "cluster", "c", "", "ECS Cluster name")
+	cmd.MarkFlagRequired("cluster")
+	cmd.Flags().BoolVar(&opts.All, "all", false, "Rotate every node, not only the outdated ones")
+	cmd.Flags().BoolVar(&opts.InstanceRefresh, "instance-refresh", false, "Start an instance refresh on the Auto Scaling groups instead of terminating nodes, this replaces every instance in the groups")
+	cmd.Flags().BoolVarP(&opts.Force, "force", "f", false, "Terminate nodes even if standalone tasks are still running on them")
+	cmd.Flags().BoolVarP(&opts.Yes, "yes", "y", false, "Skip the confirmation prompt")
+	cmd.Flags().IntVar(&timeoutSec, "timeout", 1800, "Seconds to wait for each node to drain and be replaced")
+
+	return cmd
+}
+
+func rotateNodes(ctx context.Context, opts RotateNodesOptions) error {
+	nodes, err := GetNodeVersions(ctx, opts.Cluster)
+	if err != nil {
+		return err
+	}
+	if len(nodes) == 0 {
+		return printNoNodes(ctx, opts.Cluster)
+	}
+
+	var targets []NodeVersion
+	for _, n := range nodes {
+		if opts.All || n.Outdated() {
+			targets = append(targets, n)
+		}
+	}
+	if len(targets) == 0 {
+		fmt.Println("All nodes are up to date")
+		return nil
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	client := awsecs.NewFromConfig(cfg.AwsConfig)
+	asg := autoscaling.NewFromConfig(cfg.AwsConfig)
+
+	var ids []string
+	for _, n := range targets {
+		ids = append(ids, n.Node.Ec2InstanceID)
+	}
+	groups, err := instanceGroups(ctx, asg, ids)
+	if err != nil {
+		return err
+	}
+
+	// Nothing replaces an instance outside an Auto Scaling group
+	for _, n := range targets {
+		if groups[n.Node.Ec2InstanceID] == "" {
+			return fmt.Errorf("node %s (%s) is not in an Auto Scaling group, nothing would replace it", n.Node.ID, n.Node.Ec2InstanceID)
+		}
+	}
+
+	// Draining only moves service tasks, standalone tasks would be killed with the instance
+	if !opts.Force {
+		for _, n := range targets {
+			if err := checkStandaloneTasks(ctx, client, opts.Cluster, n.Node); err != nil {
+				return err
+			}
+		}
+	}
+
+	printNodeVersions(targets)
+	fmt.Println()
+
+	prompt := fmt.Sprintf("Rotate %d nodes in %s? [y/N] ", len(targets), opts.Cluster)
+	if opts.InstanceRefresh {
+		names := make(map[string]bool)
+		for _, name := range groups {
+			names[name] = true
+		}
+		prompt = fmt.Sprintf("Refresh %d Auto Scaling groups? Every instance in them is replaced, not only the %d nodes above [y/N] ", len(names), len(targets))
+	}
+	if !opts.Yes && !utils.Confirm(prompt, "y") {
+		return errors.New("nodes not rotated")
+	}
+
+	known := make(map[string]bool) // nodes registered before the rotation
+	for _, n := range nodes {
+		known[n.Node.ID] = true
+	}
+
+	if opts.InstanceRefresh {
+		if err := refreshGroups(ctx, asg, groups, opts.Timeout*time.Duration(len(targets))); err != nil {
+			return err
+		}
+		return checkReplacements(ctx, opts.Cluster, known)
+	}
+
+	active := 0
+	for _, n := range nodes {
+		if n.Node.Status == "ACTIVE" && n.Node.AgentConnected {
+			active++
+		}
+	}
+
+	rotated := make(map[string]bool)
+	for i, n := range targets {
+		fmt.Printf("[%d/%d] Rotating node %s (%s)\n", i+1, len(targets), n.Node.ID, n.Node.Ec2InstanceID)
+
+		instance := n.Node.Instance
+		if err := setNodeState(ctx, client, opts.Cluster, &instance, ectypes.ContainerInstanceStatusDraining); err != nil {
+			return err
+		}
+		if err := waitNodeDrained(ctx, client, opts.Cluster, n.Node.Arn, opts.Timeout); err != nil {
+			return err
+		}
+		if !opts.Force {
+			if err := checkStandaloneTasks(ctx, client, opts.Cluster, n.Node); err != nil {
+				return fmt.Errorf("%w; the node is left DRAINING", err)
+			}
+		}
+
+		// Keep the desired capacity so the group launches a replacement on the current launch template
+		_, err := asg.TerminateInstanceInAutoScalingGroup(ctx, &autoscaling.TerminateInstanceInAutoScalingGroupInput{
+			InstanceId:                     aws.String(n.Node.Ec2InstanceID),
+			ShouldDecrementDesiredCapacity: aws.Bool(false),
+		})
+		if err != nil {
+			return fmt.Errorf("terminate instance %s: %w", n.Node.Ec2InstanceID, err)
+		}
+		fmt.Printf("EC2 instance %s terminating, waiting for a replacement in %s\n", n.Node.Ec2InstanceID, groups[n.Node.Ec2InstanceID])
+		rotated[n.Node.ID] = true
+
+		if err := waitReplacement(ctx, opts.Cluster, rotated, active, opts.Timeout); err != nil {
+			return err
+		}
+		if err := checkReplacements(ctx, opts.Cluster, known); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("%d nodes rotated\n", len(targets))
+	return nil
+}
+
+// checkReplacements fails when a node that joined the cluster during the rotation is still outdated, the
+// Auto Scaling group launches from a template that would only bring back the same version. The new nodes
+// are added to known.
+func checkReplacements(ctx context.Context, cluster string, known map[string]bool) error {
+	nodes, err := GetNodeVersions(ctx, cluster)
+	if err != nil {
+		return err
+	}
+
+	for _, n := range nodes {
+		if known[n.Node.ID] {
+			continue
+		}
+		known[n.Node.ID] = true
+
+		if n.Outdated() {
+			printNodeVersions([]NodeVersion{n})
+			return fmt.Errorf("replacement node %s (%s) is still outdated, update the launch template of its Auto Scaling group before rotating again",
+				n.Node.ID, n.Node.Ec2InstanceID)
+		}
+	}
+
+	return nil
+}
+
+// checkStandaloneTasks fails when tasks that are not part of a service run on the node
+func checkStandaloneTasks(ctx context.Context, client *awsecs.Client, cluster string, node NodeOutput) error {
+	_, standalone, err := nodeTasks(ctx, client, cluster, node.Arn)
+	if err != nil {
+		return err
+	}
+	if len(standalone) == 0 {
+		return nil
+	}
+
+	var ids []string
+	for _, task := range standalone {
+		ids = append(ids, NameArn(aws.ToString(task.TaskArn)))
+	}
+	return fmt.Errorf("node %s runs %d standalone tasks (%s) that draining does not move, stop them (nami delete task ... -c %s) or use --force",
+		node.ID, len(standalone), strings.Join(ids, ", "), cluster)
+}
+
+// instanceGroups maps EC2 instance IDs to the Auto Scaling group they belong to
+func instanceGroups(ctx context.Context, client *autoscaling.Client, ids []string) (map[string]string, error) {
+	groups := make(map[string]string)
+
+	for start := 0; start < len(ids); start += 50 {
+		end := min(start+50, len(ids))
+		paginator := autoscaling.NewDescribeAutoScalingInstancesPaginator(client, &autoscaling.DescribeAutoScalingInstancesInput{
+			InstanceIds: ids[start:end],
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("describe auto scaling instances: %w", err)
+			}
+			for _, instance := range page.AutoScalingInstances {
+				groups[aws.ToString(instance.InstanceId)] = aws.ToString(instance.AutoScalingGroupName)
+			}
+		}
+	}
+
+	return groups, nil
+}
+
+// waitReplacement polls the cluster until it has as many ACTIVE, connected nodes as before the rotation,
+// not counting the nodes already rotated
+func waitReplacement(ctx context.Context, cluster string, rotated map[string]bool, want int, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	last := -1
+
+	for {
+		nodes, err := GetNodes(ctx, cluster)
+		if err != nil {
+			return err
+		}
+
+		active := 0
+		for _, n := range nodes {
+			if !rotated[n.ID] && n.Status == "ACTIVE" && n.AgentConnected {
+				active++
+			}
+		}
+
+		if active != last {
+			fmt.Printf("%d/%d nodes active\n", active, want)
+			last = active
+		}
+		if active >= want {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out after %s waiting for replacement capacity (%d/%d nodes active)", timeout, active, want)
+		}
+		time.Sleep(15 * time.Second)
+	}
+}
+
+// refreshGroups starts an instance refresh on each Auto Scaling group and waits for all of them. New
+// instances are launched before old ones are terminated; ECS drains the old ones when the capacity
+// provider uses managed draining.
+func refreshGroups(ctx context.Context, client *autoscaling.Client, instanceGroups map[string]string, timeout time.Duration) error {
+	var names []string
+	seen := make(map[string]bool)
+	for _, group := range instanceGroups {
+		if !seen[group] {
+			names = append(names, group)
+			seen[group] = true
+		}
+	}
+	sort.Strings(names)
+
+	refreshes := make(map[string]string)
+	for _, name := range names {
+		out, err := client.StartInstanceRefresh(ctx, &autoscaling.StartInstanceRefreshInput{
+			AutoScalingGroupName: aws.String(name),
+			Strategy:             astypes.RefreshStrategyRolling,
+			Preferences: &astypes.RefreshPreferences{
+				MinHealthyPercentage: aws.Int32(100),
+				MaxHealthyPercentage: aws.Int32(110),
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("start instance refresh on %s: %w", name, err)
+		}
+		refreshes[name] = aws.ToString(out.InstanceRefreshId)
+		fmt.Printf("Instance refresh %s started on %s\n", aws.ToString(out.InstanceRefreshId), name)
+	}
+
+	deadline := time.Now().Add(timeout)
+	progress := make(map[string]int32)
+
+	for len(refreshes) > 0 {
+		for _, name := range names {
+			id, ok := refreshes[name]
+			if !ok {
+				continue
+			}
+
+			out, err := client.DescribeInstanceRefreshes(ctx, &autoscaling.DescribeInstanceRefreshesInput{
+				AutoScalingGroupName: aws.String(name),
+				InstanceRefreshIds:   []string{id},
+			})
+			if err != nil {
+				return fmt.Errorf("describe instance refresh on %s: %w", name, err)
+			}
+			if len(out.InstanceRefreshes) == 0 {
+				return fmt.Errorf("instance refresh %s on %s not found", id, name)
+			}
+
+			refresh := out.InstanceRefreshes[0]
+			percent := aws.ToInt32(refresh.PercentageComplete)
+			if last, ok := progress[name]; !ok || last != percent {
+				fmt.Printf("%s: %s %d%%\n", name, refresh.Status, percent)
+				progress[name] = percent
+			}
+
+			switch refresh.Status {
+			case astypes.InstanceRefreshStatusSuccessful:
+				delete(refreshes, name)
+			case astypes.InstanceRefreshStatusFailed, astypes.InstanceRefreshStatusCancelled,
+				astypes.InstanceRefreshStatusRollbackSuccessful, astypes.InstanceRefreshStatusRollbackFailed:
+				return fmt.Errorf("instance refresh on %s %s: %s", name, refresh.Status, aws.ToString(refresh.StatusReason))
+			}
+		}
+
+		if len(refreshes) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out after %s waiting for instance refreshes", timeout)
+		}
+		time.Sleep(30 * time.Second)
+	}
+
+	fmt.Println("Instance refresh complete")
+	return nil
+}
@@ -0,0 +1,374 @@
+package ecs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	cwltypes "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	awsecs "github.com/aws/aws-sdk-go-v2/service/ecs"
+	ectypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/chnacib/nami/pkg/config"
+	"github.com/chnacib/nami/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+type RunOptions struct {
+	Cluster        string
+	Target         string // task definition (family[:revision] or ARN) or svc/<service>
+	Container      string // optional; when empty, the first essential container is used
+	Command        []string
+	Env            map[string]string
+	FromService    string // inherit network configuration and launch type from this service
+	Subnets        []string
+	SecurityGroups []string
+	PublicIP       bool
+	LaunchType     string
+	Detach         bool
+	Timeout        time.Duration
+}
+
+// Run returns the `nami run` command
+func Run() *cobra.Command {
+	var (
+		opts       RunOptions
+		command    string
+		env        []string
+		timeoutSec int
+	)
+
+	cmd := &cobra.Command{
+		Use:   "run [taskdefinition|svc/service] [-- command...]",
+		Short: "Run a one-off task, stream its logs and exit with its exit code",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.Target = args[0]
+			opts.Timeout = time.Duration(timeoutSec) * time.Second
+
+			switch {
+			case command != "" && len(args) > 1:
+				return fmt.Errorf("pass the command either with --command or after --, not both")
+			case command != "":
+				split, err := utils.SplitArgs(command)
+				if err != nil {
+					return err
+				}
+				opts.Command = split
+			case len(args) > 1:
+				opts.Command = args[1:]
+			}
+
+			opts.Env = make(map[string]string)
+			for _, kv := range env {
+				name, value, ok := strings.Cut(kv, "=")
+				if !ok {
+					return fmt.Errorf("invalid --env %q: expected KEY=VALUE", kv)
+				}
+				opts.Env[name] = value
+			}
+
+			// Ctrl-C stops following the task, the task itself keeps running
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+			defer stop()
+
+			exitCode, err := runTask(ctx, opts)
+			if err != nil {
+				return err
+			}
+
+			if exitCode != 0 {
+				stop()
+				os.Exit(exitCode)
+			}
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVarP(&opts.Cluster, "cluster", "c", "", "ECS Cluster name")
+	cmd.MarkFlagRequired("cluster")
+	cmd.Flags().StringVar(&opts.Container, "container", "", "Container to override and follow (default first essential container)")
+	cmd.Flags().StringVar(&command, "command", "", "Command override, split like a shell command line (or pass it after --)")
+	cmd.Flags().StringArrayVarP(&env, "env", "e", nil, "Environment override KEY=VALUE")
+	cmd.Flags().StringVar(&opts.FromService, "from-service", "", "Inherit network configuration and launch type from this service")
+	cmd.Flags().StringSliceVar(&opts.Subnets, "subnets", nil, "Subnets for awsvpc tasks")
+	cmd.Flags().StringSliceVar(&opts.SecurityGroups, "security-groups", nil, "Security groups for awsvpc tasks")
+	cmd.Flags().BoolVar(&opts.PublicIP, "public-ip", false, "Assign a public IP")
+	cmd.Flags().StringVar(&opts.LaunchType, "launch-type", "", "FARGATE, EC2 or EXTERNAL (default inherited or cluster default)")
+	cmd.Flags().BoolVarP(&opts.Detach, "detach", "d", false, "Print the task ARN and return without waiting")
+	cmd.Flags().IntVar(&timeoutSec, "timeout", 3600, "Seconds to wait for the task to stop")
+
+	return cmd
+}
+
+// runTask starts the task and, unless detached, follows its logs until it stops and returns the container exit code
+func runTask(ctx context.Context, opts RunOptions) (int, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return 1, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	client := awsecs.NewFromConfig(cfg.AwsConfig)
+
+	input, td, container, err := runTaskInput(ctx, client, opts)
+	if err != nil {
+		return 1, err
+	}
+
+	runOut, err := client.RunTask(ctx, input)
+	if err != nil {
+		return 1, fmt.Errorf("run task: %w", err)
+	}
+	for _, failure := range runOut.Failures {
+		return 1, fmt.Errorf("run task failed: %s (%s)", aws.ToString(failure.Reason), aws.ToString(failure.Detail))
+	}
+	if len(runOut.Tasks) == 0 {
+		return 1, errors.New("run task returned no task")
+	}
+
+	taskArn := aws.ToString(runOut.Tasks[0].TaskArn)
+	if opts.Detach {
+		fmt.Println(taskArn)
+		return 0, nil
+	}
+
+	fmt.Fprintf(os.Stderr, "Task %s started (%s)\n", NameArn(taskArn), NameArn(aws.ToString(td.TaskDefinitionArn)))
+
+	return followTask(ctx, cfg.AwsConfig, client, opts.Cluster, taskArn, container, opts.Timeout)
+}
+
+// runTaskInput builds the RunTask request for opts and returns it with the task definition and the container to follow
+func runTaskInput(ctx context.Context, client *awsecs.Client, opts RunOptions) (*awsecs.RunTaskInput, *ectypes.TaskDefinition, *ectypes.ContainerDefinition, error) {
+	input := &awsecs.RunTaskInput{
+		Cluster:   aws.String(opts.Cluster),
+		Count:     aws.Int32(1),
+		StartedBy: aws.String("nami"),
+	}
+
+	fromService := opts.FromService
+	if name, ok := strings.CutPrefix(opts.Target, "svc/"); ok {
+		fromService = name
+	} else if name, ok := strings.CutPrefix(opts.Target, "service/"); ok {
+		fromService = name
+	} else {
+		input.TaskDefinition = aws.String(opts.Target)
+	}
+
+	if fromService != "" {
+		svc, td, err := describeServiceTaskDefinition(ctx, client, opts.Cluster, fromService)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if input.TaskDefinition == nil {
+			input.TaskDefinition = td.TaskDefinitionArn
+		}
+		input.NetworkConfiguration = svc.NetworkConfiguration
+		input.LaunchType = svc.LaunchType
+		input.CapacityProviderStrategy = svc.CapacityProviderStrategy
+		input.PlatformVersion = svc.PlatformVersion
+		input.PropagateTags = ectypes.PropagateTagsTaskDefinition
+	}
+
+	if len(opts.Subnets) > 0 || len(opts.SecurityGroups) > 0 {
+		vpc := &ectypes.AwsVpcConfiguration{
+			Subnets:        opts.Subnets,
+			SecurityGroups: opts.SecurityGroups,
+			AssignPublicIp: ectypes.AssignPublicIpDisabled,
+		}
+		if input.NetworkConfiguration != nil && input.NetworkConfiguration.AwsvpcConfiguration != nil {
+			inherited := *input.NetworkConfiguration.AwsvpcConfiguration
+			if len(vpc.Subnets) == 0 {
+				vpc.Subnets = inherited.Subnets
+			}
+			if len(vpc.SecurityGroups) == 0 {
+				vpc.SecurityGroups = inherited.SecurityGroups
+			}
+			vpc.AssignPublicIp = inherited.AssignPublicIp
+		}
+		input.NetworkConfiguration = &ectypes.NetworkConfiguration{AwsvpcConfiguration: vpc}
+	}
+	if opts.PublicIP && input.NetworkConfiguration != nil && input.NetworkConfiguration.AwsvpcConfiguration != nil {
+		input.NetworkConfiguration.AwsvpcConfiguration.AssignPublicIp = ectypes.AssignPublicIpEnabled
+	}
+	if opts.LaunchType != "" {
+		input.LaunchType = ectypes.LaunchType(strings.ToUpper(opts.LaunchType))
+		input.CapacityProviderStrategy = nil
+	}
+
+	tdOut, err := client.DescribeTaskDefinition(ctx, &awsecs.DescribeTaskDefinitionInput{
+		TaskDefinition: input.TaskDefinition,
+	})
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("describe task definition %q: %w", aws.ToString(input.TaskDefinition), err)
+	}
+
+	container, err := runContainer(tdOut.TaskDefinition, opts.Container)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if len(opts.Command) > 0 || len(opts.Env) > 0 {
+		override := ectypes.ContainerOverride{
+			Name:    container.Name,
+			Command: opts.Command,
+		}
+		for name, value := range opts.Env {
+			override.Environment = append(override.Environment, ectypes.KeyValuePair{Name: aws.String(name), Value: aws.String(value)})
+		}
+		input.Overrides = &ectypes.TaskOverride{ContainerOverrides: []ectypes.ContainerOverride{override}}
+	}
+
+	return input, tdOut.TaskDefinition, container, nil
+}
+
+// followTask streams the container's logs until the task stops and returns the container exit code
+func followTask(ctx context.Context, cfg aws.Config, client *awsecs.Client, cluster, taskArn string, container *ectypes.ContainerDefinition, timeout time.Duration) (int, error) {
+	taskID := NameArn(taskArn)
+
+	var follower *logFollower
+	if lc := container.LogConfiguration; lc != nil && lc.LogDriver == ectypes.LogDriverAwslogs && lc.Options["awslogs-stream-prefix"] != "" {
+		follower = &logFollower{
+			client: cloudwatchlogs.NewFromConfig(cfg),
+			group:  lc.Options["awslogs-group"],
+			stream: fmt.Sprintf("%s/%s/%s", lc.Options["awslogs-stream-prefix"], aws.ToString(container.Name), taskID),
+		}
+	} else {
+		fmt.Fprintf(os.Stderr, "Container %s does not use awslogs, logs will not be streamed\n", aws.ToString(container.Name))
+	}
+
+	task, err := waitTaskStopped(ctx, client, cluster, taskArn, timeout, follower)
+	if err != nil {
+		return 1, err
+	}
+
+	for _, c := range task.Containers {
+		if aws.ToString(c.Name) != aws.ToString(container.Name) {
+			continue
+		}
+		if c.ExitCode == nil {
+			return 1, fmt.Errorf("task %s stopped without an exit code: %s %s", taskID, aws.ToString(task.StoppedReason), aws.ToString(c.Reason))
+		}
+		fmt.Fprintf(os.Stderr, "Task %s stopped, %s exited with code %d\n", taskID, aws.ToString(c.Name), aws.ToInt32(c.ExitCode))
+		return int(aws.ToInt32(c.ExitCode)), nil
+	}
+
+	return 1, fmt.Errorf("container %s not found in stopped task %s: %s", aws.ToString(container.Name), taskID, aws.ToString(task.StoppedReason))
+}
+
+// runContainer picks the named container, or the first essential one
+func runContainer(td *ectypes.TaskDefinition, name string) (*ectypes.ContainerDefinition, error) {
+	if len(td.ContainerDefinitions) == 0 {
+		return nil, fmt.Errorf("task definition %q has no container definitions", aws.ToString(td.TaskDefinitionArn))
+	}
+
+	for i, c := range td.ContainerDefinitions {
+		if name != "" && aws.ToString(c.Name) == name {
+			return &td.ContainerDefinitions[i], nil
+		}
+		if name == "" && (c.Essential == nil || aws.ToBool(c.Essential)) {
+			return &td.ContainerDefinitions[i], nil
+		}
+	}
+
+	if name != "" {
+		return nil, fmt.Errorf("container %q not found in task definition %q", name, aws.ToString(td.TaskDefinitionArn))
+	}
+	return &td.ContainerDefinitions[0], nil
+}
+
+// waitTaskStopped polls the task until it is STOPPED, printing status changes and following its logs
+func waitTaskStopped(ctx context.Context, client *awsecs.Client, cluster, taskArn string, timeout time.Duration, follower *logFollower) (*ectypes.Task, error) {
+	deadline := time.Now().Add(timeout)
+	lastStatus := ""
+
+	for {
+		out, err := client.DescribeTasks(ctx, &awsecs.DescribeTasksInput{
+			Cluster: aws.String(cluster),
+			Tasks:   []string{taskArn},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("describe task: %w", err)
+		}
+		if len(out.Tasks) == 0 {
+			return nil, fmt.Errorf("task %s not found", NameArn(taskArn))
+		}
+
+		task := out.Tasks[0]
+		status := aws.ToString(task.LastStatus)
+		if status != lastStatus {
+			fmt.Fprintf(os.Stderr, "Task %s is %s\n", NameArn(taskArn), status)
+			lastStatus = status
+		}
+
+		if follower != nil {
+			follower.poll(ctx)
+		}
+
+		if status == "STOPPED" {
+			if follower != nil {
+				// Logs can land shortly after the task stops
+				select {
+				case <-ctx.Done():
+				case <-time.After(3 * time.Second):
+					follower.poll(ctx)
+				}
+			}
+			return &task, nil
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out after %s waiting for task %s to stop", timeout, NameArn(taskArn))
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("stopped following task %s, it is still running: %w", NameArn(taskArn), ctx.Err())
+		case <-time.After(3 * time.Second):
+		}
+	}
+}
+
+type logFollower struct {
+	client *cloudwatchlogs.Client
+	group  string
+	stream string
+	token  *string
+}
+
+// poll prints the log events written since the last poll
+func (f *logFollower) poll(ctx context.Context) {
+	for {
+		out, err := f.client.GetLogEvents(ctx, &cloudwatchlogs.GetLogEventsInput{
+			LogGroupName:  aws.String(f.group),
+			LogStreamName: aws.String(f.stream),
+			StartFromHead: aws.Bool(true),
+			NextToken:     f.token,
+		})
+		if err != nil {
+			var notFound *cwltypes.ResourceNotFoundException
+			if !errors.As(err, &notFound) {
+				fmt.Fprintf(os.Stderr, "Warning: reading logs: %v\n", err)
+			}
+			return
+		}
+
+		for _, event := range out.Events {
+			fmt.Println(aws.ToString(event.Message))
+		}
+
+		// The forward token stays the same once the end of the stream is reached
+		if out.NextForwardToken == nil || aws.ToString(out.NextForwardToken) == aws.ToString(f.token) {
+			return
+		}
+		f.token = out.NextForwardToken
+		if len(out.Events) == 0 {
+			return
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package ecs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/applicationautoscaling"
+	"github.com/aws/aws-sdk-go-v2/service/applicationautoscaling/types"
+	awsecs "github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/spf13/cobra"
+)
+
+type ScheduleOptions struct {
+	Cluster  string
+	Service  string
+	Name     string
+	Cron     string
+	Timezone string
+	Min      *int32
+	Max      *int32
+	Start    *time.Time
+	End      *time.Time
+}
+
+// Schedule returns the `nami set schedule` command
+func Schedule() *cobra.Command {
+	var (
+		cluster  string
+		name     string
+		cron     string
+		timezone string
+		minimum  int32
+		maximum  int32
+		start    string
+		end      string
+	)
+
+	cmd := &cobra.Command{
+		Use:     "schedule [service]",
+		Aliases: []string{"schedules"},
+		Short:   "Register a scheduled scaling action",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts := ScheduleOptions{
+				Cluster:  cluster,
+				Service:  args[0],
+				Name:     name,
+				Cron:     cron,
+				Timezone: timezone,
+			}
+
+			if cmd.Flags().Changed("min") {
+				opts.Min = aws.Int32(minimum)
+			}
+			if cmd.Flags().Changed("max") {
+				opts.Max = aws.Int32(maximum)
+			}
+			if opts.Min == nil && opts.Max == nil {
+				return fmt.Errorf("at least one of --min or --max is required")
+			}
+
+			for flag, value := range map[string]string{"start": start, "end": end} {
+				if value == "" {
+					continue
+				}
+				t, err := time.Parse(time.RFC3339, value)
+				if err != nil {
+					return fmt.Errorf("invalid --%s %q: use RFC3339 (2006-01-02T15:04:05Z)", flag, value)
+				}
+				if flag == "start" {
+					opts.Start = &t
+				} else {
+					opts.End = &t
+				}
+			}
+
+			actionName, err := putScheduledAction(cmd.Context(), opts)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Scheduled action %s configured for %s\n", actionName, opts.Service)
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVarP(&cluster, "cluster", "c", "", "ECS Cluster name")
+	cmd.MarkFlagRequired("cluster")
+	cmd.Flags().StringVar(&cron, "cron", "", "Cron expression (\"0 20 * * MON-FRI\"), or an at(...)/rate(...)/cron(...) schedule")
+	cmd.MarkFlagRequired("cron")
+	cmd.Flags().StringVar(&name, "name", "", "Scheduled action name (default derived from the schedule)")
+	cmd.Flags().StringVar(&timezone, "timezone", "UTC", "IANA time zone of the schedule (e.g. America/Sao_Paulo)")
+	cmd.Flags().Int32Var(&minimum, "min", 0, "Minimum desired count")
+	cmd.Flags().Int32Var(&maximum, "max", 0, "Maximum desired count")
+	cmd.Flags().StringVar(&start, "start", "", "Only run the schedule after this time (RFC3339)")
+	cmd.Flags().StringVar(&end, "end", "", "Only run the schedule until this time (RFC3339)")
+
+	return cmd
+}
+
+func putScheduledAction(ctx context.Context, opts ScheduleOptions) (string, error) {
+	if _, err := time.LoadLocation(opts.Timezone); err != nil {
+		return "", fmt.Errorf("invalid timezone %q: %w", opts.Timezone, err)
+	}
+
+	schedule, err := awsSchedule(opts.Cron)
+	if err != nil {
+		return "", err
+	}
+
+	name := opts.Name
+	if name == "" {
+		name = scheduledActionName(opts)
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return "", fmt.Errorf("loading AWS config: %w", err)
+	}
+
+	client := applicationautoscaling.NewFromConfig(cfg)
+	resourceID := fmt.Sprintf("service/%s/%s", opts.Cluster, opts.Service)
+
+	input := &applicationautoscaling.PutScheduledActionInput{
+		ServiceNamespace:    types.ServiceNamespaceEcs,
+		ScalableDimension:   types.ScalableDimensionECSServiceDesiredCount,
+		ResourceId:          aws.String(resourceID),
+		ScheduledActionName: aws.String(name),
+		Schedule:            aws.String(schedule),
+		Timezone:            aws.String(opts.Timezone),
+		StartTime:           opts.Start,
+		EndTime:             opts.End,
+		ScalableTargetAction: &types.ScalableTargetAction{
+			MinCapacity: opts.Min,
+			MaxCapacity: opts.Max,
+		},
+	}
+
+	_, err = client.PutScheduledAction(ctx, input)
+
+	var notFound *types.ObjectNotFoundException
+	if errors.As(err, &notFound) {
+		// Scheduled actions need a scalable target; register one pinned to the current desired count
+		var desired int32
+		desired, err = currentDesiredCount(ctx, awsecs.NewFromConfig(cfg), opts.Cluster, opts.Service)
+		if err != nil {
+			return "", err
+		}
+
+		_, err = client.RegisterScalableTarget(ctx, &applicationautoscaling.RegisterScalableTargetInput{
+			ServiceNamespace:  types.ServiceNamespaceEcs,
+			ScalableDimension: types.ScalableDimensionECSServiceDesiredCount,
+			ResourceId:        aws.String(resourceID),
+			MinCapacity:       aws.Int32(desired),
+			MaxCapacity:       aws.Int32(desired),
+		})
+		if err != nil {
+			return "", fmt.Errorf("register scalable target: %w", err)
+		}
+		fmt.Printf("Registered scalable target for %s with min/max %d\n", opts.Service, desired)
+
+		_, err = client.PutScheduledAction(ctx, input)
+	}
+	if err != nil {
+		return "", fmt.Errorf("put scheduled action: %w", err)
+	}
+
+	return name, nil
+}
+
+func currentDesiredCount(ctx context.Context, client *awsecs.Client, cluster, service string) (int32, error) {
+	out, err := client.DescribeServices(ctx, &awsecs.DescribeServicesInput{
+		Cluster:  aws.String(cluster),
+		Services: []string{service},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("describe service: %w", err)
+	}
+	if len(out.Services) == 0 {
+		return 0, fmt.Errorf("service %q not found in cluster %q", service, cluster)
+	}
+
+	return out.Services[0].DesiredCount, nil
+}
+
+var cronNumber = regexp.MustCompile(`\d+`)
+
+// awsSchedule converts a standard 5-field cron expression to the Application Auto Scaling and
+// EventBridge Scheduler cron(minutes hours day-of-month month day-of-week year) format. at(), rate() and cron()
+// expressions are passed through.
+func awsSchedule(expr string) (string, error) {
+	expr = strings.TrimSpace(expr)
+	for _, prefix := range []string{"cron(", "at(", "rate("} {
+		if strings.HasPrefix(expr, prefix) {
+			return expr, nil
+		}
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return "", fmt.Errorf("invalid cron %q: expected 5 fields (minute hour day-of-month month day-of-week)", expr)
+	}
+
+	dom, dow := fields[2], fields[4]
+
+	dow = awsWeekdays(dow)
+
+	// AWS requires one of day-of-month and day-of-week to be "?"
+	if dow == "*" {
+		dow = "?"
+	} else {
+		if dom != "*" {
+			return "", fmt.Errorf("invalid cron %q: day-of-month and day-of-week cannot both be set", expr)
+		}
+		dom = "?"
+	}
+
+	return fmt.Sprintf("cron(%s %s %s %s %s *)", fields[0], fields[1], dom, fields[3], dow), nil
+}
+
+// awsWeekdays renumbers a cron day-of-week field, cron counts weekdays from 0 (Sunday) and also accepts 7,
+// AWS counts from 1 (Sunday). In day#n only the day is a weekday. Ranges are renumbered as a pair, a range
+// reaching 7 would wrap to 1 so it is written as a list.
+func awsWeekdays(dow string) string {
+	items := strings.Split(dow, ",")
+	for i, item := range items {
+		item, nth, hasNth := strings.Cut(item, "#")
+		base, step, hasStep := strings.Cut(item, "/")
+
+		lo, hi, isRange := strings.Cut(base, "-")
+		from, errFrom := strconv.Atoi(lo)
+		to, errTo := strconv.Atoi(hi)
+		every, errEvery := 1, error(nil)
+		if hasStep {
+			every, errEvery = strconv.Atoi(step)
+		}
+
+		if isRange && errFrom == nil && errTo == nil && to == 7 && errEvery == nil && every > 0 {
+			var days []string
+			seen := make(map[int]bool)
+			for d := from; d <= to; d += every {
+				if day := d%7 + 1; !seen[day] {
+					seen[day] = true
+					days = append(days, strconv.Itoa(day))
+				}
+			}
+			items[i] = strings.Join(days, ",")
+			continue
+		}
+
+		item = cronNumber.ReplaceAllStringFunc(base, func(n string) string {
+			v, _ := strconv.Atoi(n)
+			return strconv.Itoa(v%7 + 1)
+		})
+		if hasStep {
+			item += "/" + step
+		}
+		if hasNth {
+			item += "#" + nth
+		}
+		items[i] = item
+	}
+	return strings.Join(items, ",")
+}
+
+var actionNameReplacer = strings.NewReplacer(" ", "_", "*", "x", "?", "x", "/", "-", ":", "-", "(", "", ")", "", ",", ".")
+
+func scheduledActionName(opts ScheduleOptions) string {
+	name := "nami"
+	if opts.Min != nil {
+		name += fmt.Sprintf("-min%d", *opts.Min)
+	}
+	if opts.Max != nil {
+		name += fmt.Sprintf("-max%d", *opts.Max)
+	}
+	return name + "-" + actionNameReplacer.Replace(strings.TrimSpace(opts.Cron))
+}
@@ -0,0 +1,51 @@
+package ecs
+
+import "testing"
+
+func TestAwsSchedule(t *testing.T) {
+	tests := []struct {
+		expr    string
+		want    string
+		wantErr bool
+	}{
+		{expr: "0 3 * * *", want: "cron(0 3 * * ? *)"},
+		{expr: "30 8 1 * *", want: "cron(30 8 1 * ? *)"},
+		{expr: "0 9 * * 1-5", want: "cron(0 9 ? * 2-6 *)"},
+		{expr: "0 9 * * 0,6", want: "cron(0 9 ? * 1,7 *)"},
+		{expr: "0 9 * * 7", want: "cron(0 9 ? * 1 *)"},
+		{expr: "0 9 * * 1#2", want: "cron(0 9 ? * 2#2 *)"},
+		{expr: "0 9 * * 0#1", want: "cron(0 9 ? * 1#1 *)"},
+		{expr: "0 9 * * */2", want: "cron(0 9 ? * */2 *)"},
+		{expr: "0 9 * * 1-5/2", want: "cron(0 9 ? * 2-6/2 *)"},
+		{expr: "0 9 * * 1/2", want: "cron(0 9 ? * 2/2 *)"},
+		{expr: "0 9 * * 5-7", want: "cron(0 9 ? * 6,7,1 *)"},
+		{expr: "0 9 * * 1-7", want: "cron(0 9 ? * 2,3,4,5,6,7,1 *)"},
+		{expr: "0 9 * * 0-7", want: "cron(0 9 ? * 1,2,3,4,5,6,7 *)"},
+		{expr: "0 9 * * 1-7/2", want: "cron(0 9 ? * 2,4,6,1 *)"},
+		{expr: "0 9 * * 0-2,6-7", want: "cron(0 9 ? * 1-3,7,1 *)"},
+		{expr: "0 9 * * MON-FRI", want: "cron(0 9 ? * MON-FRI *)"},
+		{expr: "  0 3 * * *  ", want: "cron(0 3 * * ? *)"},
+		{expr: "cron(0 3 * * ? *)", want: "cron(0 3 * * ? *)"},
+		{expr: "rate(5 minutes)", want: "rate(5 minutes)"},
+		{expr: "at(2026-01-01T00:00:00)", want: "at(2026-01-01T00:00:00)"},
+		{expr: "0 3 * *", wantErr: true},
+		{expr: "0 3 1 * 1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := awsSchedule(tt.expr)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("awsSchedule(%q) = %q, want an error", tt.expr, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("awsSchedule(%q) returned error: %v", tt.expr, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("awsSchedule(%q) = %q, want %q", tt.expr, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,485 @@
+package ecs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/applicationautoscaling"
+	"github.com/aws/aws-sdk-go-v2/service/applicationautoscaling/types"
+	awsecs "github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/chnacib/nami/pkg/config"
+	"github.com/chnacib/nami/pkg/cw"
+	"github.com/chnacib/nami/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+// SimulationConfig is the target tracking setup replayed by `nami autoscale simulate`
+type SimulationConfig struct {
+	Min              int32   `json:"min"`
+	Max              int32   `json:"max"`
+	CPU              float64 `json:"cpu"`
+	Memory           float64 `json:"memory"`
+	Requests         float64 `json:"requests"`
+	ScaleInCooldown  int32   `json:"scaleInCooldown"`
+	ScaleOutCooldown int32   `json:"scaleOutCooldown"`
+	DisableScaleIn   bool    `json:"disableScaleIn"`
+}
+
+// SimulationFixture is the file written by --record and read by --fixture
+type SimulationFixture struct {
+	Config  SimulationConfig   `json:"config"`
+	History *cw.ServiceHistory `json:"history"`
+}
+
+type SimulationPoint struct {
+	Time      time.Time
+	Actual    float64
+	Simulated int32
+}
+
+type SimulationResult struct {
+	Points    []SimulationPoint
+	ScaleOuts int
+	ScaleIns  int
+}
+
+// Target tracking alarms need 3 minutes above target to scale out and 15 minutes below to scale in
+const (
+	scaleOutEvaluation = 3 * time.Minute
+	scaleInEvaluation  = 15 * time.Minute
+)
+
+// Simulate returns the `nami autoscale simulate` command
+func Simulate() *cobra.Command {
+	var (
+		cluster          string
+		since            string
+		period           int32
+		fixture          string
+		record           string
+		width            int
+		cpu              float64
+		mem              float64
+		request          float64
+		minimum          int32
+		maximum          int32
+		scaleInCooldown  int32
+		scaleOutCooldown int32
+		disableScaleIn   bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "simulate [service]",
+		Short: "Replay metric history against proposed target tracking settings",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			var data *SimulationFixture
+			var err error
+
+			if fixture != "" {
+				data, err = loadSimulationFixture(fixture)
+			} else {
+				if len(args) == 0 || cluster == "" {
+					return fmt.Errorf("service and --cluster are required unless --fixture is set")
+				}
+				window, perr := utils.ParseDuration(since)
+				if perr != nil {
+					return perr
+				}
+				data, err = fetchSimulationData(ctx, cluster, args[0], window, period)
+			}
+			if err != nil {
+				return err
+			}
+
+			if record != "" {
+				if err := saveSimulationFixture(record, data); err != nil {
+					return err
+				}
+				fmt.Printf("Recorded %d samples to %s\n", len(data.History.Samples), record)
+			}
+
+			proposed := data.Config
+			flags := cmd.Flags()
+			if flags.Changed("cpu") {
+				proposed.CPU = cpu
+			}
+			if flags.Changed("mem") {
+				proposed.Memory = mem
+			}
+			if flags.Changed("request") {
+				proposed.Requests = request
+			}
+			if flags.Changed("min") {
+				proposed.Min = minimum
+			}
+			if flags.Changed("max") {
+				proposed.Max = maximum
+			}
+			if flags.Changed("scale-in-cooldown") {
+				proposed.ScaleInCooldown = scaleInCooldown
+			}
+			if flags.Changed("scale-out-cooldown") {
+				proposed.ScaleOutCooldown = scaleOutCooldown
+			}
+			if flags.Changed("disable-scale-in") {
+				proposed.DisableScaleIn = disableScaleIn
+			}
+
+			if proposed.CPU == 0 && proposed.Memory == 0 && proposed.Requests == 0 {
+				return fmt.Errorf("no target to simulate: set --cpu, --mem or --request")
+			}
+			if proposed.Max == 0 || proposed.Min > proposed.Max {
+				return fmt.Errorf("invalid capacity range min %d max %d: set --min and --max", proposed.Min, proposed.Max)
+			}
+
+			result := simulateTargetTracking(proposed, data.History)
+			printSimulation(data, proposed, result, width)
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVarP(&cluster, "cluster", "c", "", "ECS Cluster name")
+	cmd.Flags().StringVar(&since, "since", "7d", "History window (e.g. 24h, 7d)")
+	cmd.Flags().Int32Var(&period, "period", 300, "Metric period in seconds")
+	cmd.Flags().StringVar(&fixture, "fixture", "", "Replay a recorded metrics file instead of reading CloudWatch")
+	cmd.Flags().StringVar(&record, "record", "", "Save the metrics and current config to a file for offline replay")
+	cmd.Flags().IntVar(&width, "width", 80, "Chart width in columns")
+	cmd.Flags().Float64Var(&cpu, "cpu", 0, "Proposed CPU target (%)")
+	cmd.Flags().Float64Var(&mem, "mem", 0, "Proposed memory target (%)")
+	cmd.Flags().Float64Var(&request, "request", 0, "Proposed ALB requests per target per minute")
+	cmd.Flags().Int32Var(&minimum, "min", 0, "Proposed minimum desired count")
+	cmd.Flags().Int32Var(&maximum, "max", 0, "Proposed maximum desired count")
+	cmd.Flags().Int32Var(&scaleInCooldown, "scale-in-cooldown", 300, "Proposed scale-in cooldown in seconds")
+	cmd.Flags().Int32Var(&scaleOutCooldown, "scale-out-cooldown", 60, "Proposed scale-out cooldown in seconds")
+	cmd.Flags().BoolVar(&disableScaleIn, "disable-scale-in", false, "Proposed policies only scale out")
+
+	return cmd
+}
+
+// fetchSimulationData reads the service's metric history and its current target tracking config
+func fetchSimulationData(ctx context.Context, cluster, service string, window time.Duration, period int32) (*SimulationFixture, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	svcOut, err := awsecs.NewFromConfig(cfg.AwsConfig).DescribeServices(ctx, &awsecs.DescribeServicesInput{
+		Cluster:  aws.String(cluster),
+		Services: []string{service},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("describe service: %w", err)
+	}
+	if len(svcOut.Services) == 0 {
+		return nil, fmt.Errorf("service %q not found in cluster %q", service, cluster)
+	}
+
+	targetGroup := ""
+	if lbs := svcOut.Services[0].LoadBalancers; len(lbs) > 0 {
+		targetGroup = extractTargetGroupID(aws.ToString(lbs[0].TargetGroupArn))
+	}
+
+	end := time.Now()
+	history, err := cw.GetServiceHistory(ctx, cfg.AwsConfig, cluster, service, targetGroup, end.Add(-window), end, period)
+	if err != nil {
+		return nil, err
+	}
+	if len(history.Samples) == 0 {
+		return nil, fmt.Errorf("no metrics found for %s in the last %s", service, window)
+	}
+
+	current, err := currentSimulationConfig(ctx, applicationautoscaling.NewFromConfig(cfg.AwsConfig), fmt.Sprintf("service/%s/%s", cluster, service))
+	if err != nil {
+		return nil, err
+	}
+
+	return &SimulationFixture{Config: current, History: history}, nil
+}
+
+// currentSimulationConfig reads the registered min/max and target tracking policies of a service
+func currentSimulationConfig(ctx context.Context, client *applicationautoscaling.Client, resourceID string) (SimulationConfig, error) {
+	current := SimulationConfig{ScaleInCooldown: 300, ScaleOutCooldown: 300}
+
+	targets, err := client.DescribeScalableTargets(ctx, &applicationautoscaling.DescribeScalableTargetsInput{
+		ServiceNamespace:  types.ServiceNamespaceEcs,
+		ScalableDimension: types.ScalableDimensionECSServiceDesiredCount,
+		ResourceIds:       []string{resourceID},
+	})
+	if err != nil {
+		return current, fmt.Errorf("describe scalable target: %w", err)
+	}
+	for _, t := range targets.ScalableTargets {
+		current.Min = aws.ToInt32(t.MinCapacity)
+		current.Max = aws.ToInt32(t.MaxCapacity)
+	}
+
+	policies, err := client.DescribeScalingPolicies(ctx, &applicationautoscaling.DescribeScalingPoliciesInput{
+		ServiceNamespace:  types.ServiceNamespaceEcs,
+		ScalableDimension: types.ScalableDimensionECSServiceDesiredCount,
+		ResourceId:        aws.String(resourceID),
+	})
+	if err != nil {
+		return current, fmt.Errorf("describe scaling policies: %w", err)
+	}
+
+	for _, p := range policies.ScalingPolicies {
+		tt := p.TargetTrackingScalingPolicyConfiguration
+		if tt == nil || tt.PredefinedMetricSpecification == nil {
+			continue
+		}
+
+		switch tt.PredefinedMetricSpecification.PredefinedMetricType {
+		case types.MetricTypeECSServiceAverageCPUUtilization:
+			current.CPU = aws.ToFloat64(tt.TargetValue)
+		case types.MetricTypeECSServiceAverageMemoryUtilization:
+			current.Memory = aws.ToFloat64(tt.TargetValue)
+		case types.MetricTypeALBRequestCountPerTarget:
+			current.Requests = aws.ToFloat64(tt.TargetValue)
+		default:
+			continue
+		}
+		current.ScaleInCooldown = aws.ToInt32(tt.ScaleInCooldown)
+		current.ScaleOutCooldown = aws.ToInt32(tt.ScaleOutCooldown)
+		current.DisableScaleIn = aws.ToBool(tt.DisableScaleIn)
+	}
+
+	return current, nil
+}
+
+// simulateTargetTracking replays the history with the given config. The load of each sample is the
+// observed utilization times the tasks that were running, and each metric asks for enough tasks to
+// bring its utilization back to the target.
+func simulateTargetTracking(cfg SimulationConfig, history *cw.ServiceHistory) SimulationResult {
+	var result SimulationResult
+	if len(history.Samples) == 0 {
+		return result
+	}
+
+	period := time.Duration(history.Period) * time.Second
+	outStreakNeeded := int(math.Max(1, math.Ceil(float64(scaleOutEvaluation)/float64(period))))
+	inStreakNeeded := int(math.Max(1, math.Ceil(float64(scaleInEvaluation)/float64(period))))
+
+	clamp := func(n int32) int32 {
+		if n < cfg.Min {
+			return cfg.Min
+		}
+		if n > cfg.Max {
+			return cfg.Max
+		}
+		return n
+	}
+
+	current := clamp(int32(math.Round(history.Samples[0].Tasks)))
+	var lastOut, lastIn time.Time
+	outStreak, inStreak := 0, 0
+
+	for _, s := range history.Samples {
+		desired := current
+
+		if s.Tasks > 0 {
+			var required int32
+			need := func(utilization, target float64) {
+				if target <= 0 {
+					return
+				}
+				n := int32(math.Ceil(utilization * s.Tasks / target))
+				if n > required {
+					required = n
+				}
+			}
+			need(s.CPU, cfg.CPU)
+			need(s.Memory, cfg.Memory)
+			// ALBRequestCountPerTarget targets are per minute
+			need(s.Requests*60/float64(history.Period), cfg.Requests)
+			desired = clamp(required)
+		}
+
+		switch {
+		case desired > current:
+			outStreak++
+			inStreak = 0
+			if outStreak >= outStreakNeeded && s.Time.Sub(lastOut) >= time.Duration(cfg.ScaleOutCooldown)*time.Second {
+				current = desired
+				lastOut = s.Time
+				outStreak = 0
+				result.ScaleOuts++
+			}
+		case desired < current && !cfg.DisableScaleIn:
+			inStreak++
+			outStreak = 0
+			if inStreak >= inStreakNeeded && s.Time.Sub(lastIn) >= time.Duration(cfg.ScaleInCooldown)*time.Second {
+				current = desired
+				lastIn = s.Time
+				inStreak = 0
+				result.ScaleIns++
+			}
+		default:
+			outStreak, inStreak = 0, 0
+		}
+
+		result.Points = append(result.Points, SimulationPoint{Time: s.Time, Actual: s.Tasks, Simulated: current})
+	}
+
+	return result
+}
+
+func printSimulation(data *SimulationFixture, proposed SimulationConfig, result SimulationResult, width int) {
+	history := data.History
+	if len(result.Points) == 0 {
+		fmt.Println("No samples to simulate")
+		return
+	}
+
+	first, last := result.Points[0].Time, result.Points[len(result.Points)-1].Time
+	fmt.Printf("%s/%s: %d samples of %ds from %s to %s\n", history.Cluster, history.Service, len(result.Points), history.Period,
+		first.Local().Format("2006-01-02 15:04"), last.Local().Format("2006-01-02 15:04"))
+	fmt.Printf("current:  %s\n", formatSimulationConfig(data.Config))
+	fmt.Printf("proposed: %s\n", formatSimulationConfig(proposed))
+	if history.TasksEstimated {
+		fmt.Println("note: Container Insights is not enabled, actual task counts are estimated")
+	}
+	fmt.Println()
+
+	fmt.Print(renderChart(result.Points, width, 12))
+	fmt.Println()
+
+	hours := float64(history.Period) / 3600
+	var actualHours, simulatedHours, actualPeak float64
+	var simulatedPeak int32
+	for _, p := range result.Points {
+		actualHours += p.Actual * hours
+		simulatedHours += float64(p.Simulated) * hours
+		actualPeak = math.Max(actualPeak, p.Actual)
+		if p.Simulated > simulatedPeak {
+			simulatedPeak = p.Simulated
+		}
+	}
+
+	fmt.Printf("actual:    peak %.0f tasks, %.1f task-hours\n", actualPeak, actualHours)
+	fmt.Printf("simulated: peak %d tasks, %.1f task-hours, %d scale-outs, %d scale-ins\n", simulatedPeak, simulatedHours, result.ScaleOuts, result.ScaleIns)
+	if actualHours > 0 {
+		fmt.Printf("change:    %+.1f%% task-hours\n", (simulatedHours-actualHours)/actualHours*100)
+	}
+}
+
+func formatSimulationConfig(c SimulationConfig) string {
+	var targets []string
+	if c.CPU > 0 {
+		targets = append(targets, fmt.Sprintf("CPU:%g", c.CPU))
+	}
+	if c.Memory > 0 {
+		targets = append(targets, fmt.Sprintf("MEMORY:%g", c.Memory))
+	}
+	if c.Requests > 0 {
+		targets = append(targets, fmt.Sprintf("REQUESTS:%g", c.Requests))
+	}
+	if len(targets) == 0 {
+		targets = append(targets, "none")
+	}
+
+	s := fmt.Sprintf("min %d, max %d, targets %s, cooldown in %ds/out %ds", c.Min, c.Max, strings.Join(targets, " "), c.ScaleInCooldown, c.ScaleOutCooldown)
+	if c.DisableScaleIn {
+		s += ", scale-in disabled"
+	}
+	return s
+}
+
+// renderChart draws simulated (*) and actual (.) task counts over time; # marks where both meet
+func renderChart(points []SimulationPoint, width, height int) string {
+	if width < 10 {
+		width = 10
+	}
+	if len(points) < width {
+		width = len(points)
+	}
+
+	actual := make([]float64, width)
+	simulated := make([]float64, width)
+	top := 1.0
+	for i, p := range points {
+		col := i * width / len(points)
+		actual[col] = math.Max(actual[col], p.Actual)
+		simulated[col] = math.Max(simulated[col], float64(p.Simulated))
+		top = math.Max(top, math.Max(p.Actual, float64(p.Simulated)))
+	}
+
+	row := func(v float64) int {
+		return int(math.Round(v / top * float64(height-1)))
+	}
+
+	var b strings.Builder
+	for r := height - 1; r >= 0; r-- {
+		label := top * float64(r) / float64(height-1)
+		if top < float64(height) {
+			fmt.Fprintf(&b, "%6.1f |", label)
+		} else {
+			fmt.Fprintf(&b, "%6.0f |", label)
+		}
+		for col := 0; col < width; col++ {
+			a, s := row(actual[col]) == r, row(simulated[col]) == r
+			switch {
+			case a && s:
+				b.WriteByte('#')
+			case s:
+				b.WriteByte('*')
+			case a:
+				b.WriteByte('.')
+			default:
+				b.WriteByte(' ')
+			}
+		}
+		b.WriteByte('\n')
+	}
+
+	fmt.Fprintf(&b, "       +%s\n", strings.Repeat("-", width))
+	start := points[0].Time.Local().Format("01-02 15:04")
+	end := points[len(points)-1].Time.Local().Format("01-02 15:04")
+	if pad := width - len(start) - len(end); pad > 0 {
+		fmt.Fprintf(&b, "        %s%s%s\n", start, strings.Repeat(" ", pad), end)
+	}
+	b.WriteString("        * simulated   . actual   # both\n")
+
+	return b.String()
+}
+
+func loadSimulationFixture(path string) (*SimulationFixture, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read fixture: %w", err)
+	}
+
+	var data SimulationFixture
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, fmt.Errorf("parse fixture %s: %w", path, err)
+	}
+	if data.History == nil || len(data.History.Samples) == 0 {
+		return nil, fmt.Errorf("fixture %s has no samples", path)
+	}
+	if data.History.Period <= 0 {
+		data.History.Period = 60
+	}
+
+	return &data, nil
+}
+
+func saveSimulationFixture(path string, data *SimulationFixture) error {
+	raw, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode fixture: %w", err)
+	}
+
+	if err := os.WriteFile(path, raw, 0o644); err != nil {
+		return fmt.Errorf("write fixture: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package ecs
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/chnacib/nami/pkg/cw"
+)
+
+// printTaskMetrics prints the usage of a task and of each of its containers
+func printTaskMetrics(m *cw.TaskMetrics, window time.Duration) {
+	fmt.Printf("\nUsage over the last %s (Container Insights):\n", window)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintf(w, "  CPU:\t%s of %s units (%s)\n", formatNumber(m.CPUUtilized), formatNumber(m.CPUReserved), formatPercent(m.CPUPercent()))
+	fmt.Fprintf(w, "  Memory:\t%s average, %s peak of %s MiB (%s)\n",
+		formatNumber(m.MemoryUtilized), formatNumber(m.MemoryMax), formatNumber(m.MemoryReserved), formatPercent(m.MemoryPercent()))
+	fmt.Fprintf(w, "  Memory change:\t%s (%s to %s MiB)\n", formatMemoryChange(m.MemoryFirst, m.MemoryLast), formatNumber(m.MemoryFirst), formatNumber(m.MemoryLast))
+	fmt.Fprintf(w, "  Network:\trx %s, tx %s\n", formatRate(m.NetworkRx), formatRate(m.NetworkTx))
+	fmt.Fprintf(w, "  Storage:\tread %s, write %s\n", formatBytes(m.StorageRead), formatBytes(m.StorageWrite))
+	if !math.IsNaN(m.EphemeralReserved) {
+		fmt.Fprintf(w, "  Ephemeral storage:\t%s of %s GiB\n", formatNumber(m.EphemeralUtilized), formatNumber(m.EphemeralReserved))
+	}
+	w.Flush()
+
+	if len(m.Containers) == 0 {
+		fmt.Println("\nPer-container usage requires Container Insights with enhanced observability")
+		return
+	}
+
+	var names []string
+	for name := range m.Containers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "CONTAINER\tCPU\tMEMORY\tMEMORY PEAK\tMEMORY CHANGE\tNET RX\tNET TX\tREAD\tWRITE")
+	for _, name := range names {
+		c := m.Containers[name]
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s MiB\t%s\t%s\t%s\t%s\t%s\n", name,
+			formatPercent(c.CPUPercent()), formatMemory(c.MemoryUtilized, c.MemoryPercent()), formatNumber(c.MemoryMax),
+			formatMemoryChange(c.MemoryFirst, c.MemoryLast), formatRate(c.NetworkRx), formatRate(c.NetworkTx),
+			formatBytes(c.StorageRead), formatBytes(c.StorageWrite))
+	}
+	w.Flush()
+}
+
+func formatNumber(v float64) string {
+	if math.IsNaN(v) {
+		return "-"
+	}
+	return fmt.Sprintf("%.0f", v)
+}
+
+func formatPercent(v float64) string {
+	if math.IsNaN(v) {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", v)
+}
+
+func formatMemory(mib, percent float64) string {
+	if math.IsNaN(mib) {
+		return "-"
+	}
+	if math.IsNaN(percent) {
+		return fmt.Sprintf("%.0f MiB", mib)
+	}
+	return fmt.Sprintf("%.0f MiB (%.0f%%)", mib, percent)
+}
+
+func formatMemoryChange(first, last float64) string {
+	if math.IsNaN(first) || math.IsNaN(last) {
+		return "-"
+	}
+	return fmt.Sprintf("%+.0f MiB", last-first)
+}
+
+func formatBytes(v float64) string {
+	if math.IsNaN(v) {
+		return "-"
+	}
+
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	i := 0
+	for v >= 1024 && i < len(units)-1 {
+		v /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0f %s", v, units[i])
+	}
+	return fmt.Sprintf("%.1f %s", v, units[i])
+}
+
+func formatRate(v float64) string {
+	if math.IsNaN(v) {
+		return "-"
+	}
+	return formatBytes(v) + "/s"
+}
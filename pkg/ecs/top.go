@@ -0,0 +1,305 @@
+package ecs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsecs "github.com/aws/aws-sdk-go-v2/service/ecs"
+	ectypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
+	"github.com/chnacib/nami/pkg/config"
+	"github.com/chnacib/nami/pkg/cw"
+	"github.com/spf13/cobra"
+)
+
+// topPeriod is the metric period of the sparklines and rates, in seconds
+const topPeriod = 60
+
+type TopOptions struct {
+	Cluster  string
+	Tasks    bool // per-task view from Container Insights
+	Interval time.Duration
+	Window   time.Duration // sparkline span, one point per minute
+	Once     bool
+}
+
+// Top returns the `nami top` command
+func Top() *cobra.Command {
+	var (
+		opts        TopOptions
+		intervalSec int
+	)
+
+	cmd := &cobra.Command{
+		Use:   "top",
+		Short: "Live CPU, memory and traffic of the services or tasks in a cluster",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if intervalSec <= 0 {
+				return fmt.Errorf("--interval must be a positive number of seconds")
+			}
+			opts.Interval = time.Duration(intervalSec) * time.Second
+			if opts.Window < 2*time.Minute {
+				return fmt.Errorf("--window must be at least 2m")
+			}
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+			defer stop()
+
+			return top(ctx, opts)
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVarP(&opts.Cluster, "cluster", "c", "", "ECS Cluster name")
+	cmd.MarkFlagRequired("cluster")
+	cmd.Flags().BoolVar(&opts.Tasks, "tasks", false, "Show each task from Container Insights instead of services")
+	cmd.Flags().IntVar(&intervalSec, "interval", 30, "Seconds between refreshes")
+	cmd.Flags().DurationVar(&opts.Window, "window", 30*time.Minute, "Time span of the sparklines")
+	cmd.Flags().BoolVar(&opts.Once, "once", false, "Print a single snapshot and exit")
+
+	return cmd
+}
+
+func top(ctx context.Context, opts TopOptions) error {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	targets := make(map[string]cw.LoadBalancerTarget) // by target group ARN, kept between refreshes
+	elb := elasticloadbalancingv2.NewFromConfig(cfg.AwsConfig)
+	client := awsecs.NewFromConfig(cfg.AwsConfig)
+
+	for {
+		var buf bytes.Buffer
+		fmt.Fprintf(&buf, "nami top - %s - %s", opts.Cluster, time.Now().Format("15:04:05"))
+		if !opts.Once {
+			fmt.Fprintf(&buf, " - every %s, Ctrl-C to quit", opts.Interval)
+		}
+		fmt.Fprint(&buf, "\n\n")
+
+		if opts.Tasks {
+			err = renderTopTasks(ctx, &buf, cfg.AwsConfig, client, opts)
+		} else {
+			err = renderTopServices(ctx, &buf, cfg.AwsConfig, elb, targets, opts)
+		}
+
+		if opts.Once {
+			os.Stdout.Write(buf.Bytes())
+			return err
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			fmt.Fprintf(&buf, "\nError: %v\n", err)
+		}
+
+		// Clear the screen and redraw from the top left corner
+		fmt.Print("\033[H\033[2J")
+		os.Stdout.Write(buf.Bytes())
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(opts.Interval):
+		}
+	}
+}
+
+func renderTopServices(ctx context.Context, buf *bytes.Buffer, cfg aws.Config, elb *elasticloadbalancingv2.Client, targets map[string]cw.LoadBalancerTarget, opts TopOptions) error {
+	services, err := GetECSServices(ctx, ServiceOptions{Cluster: opts.Cluster})
+	if err != nil {
+		return err
+	}
+
+	var unknown []string
+	for _, svc := range services {
+		for _, lb := range svc.LoadBalancers {
+			arn := aws.ToString(lb.TargetGroupArn)
+			if _, ok := targets[arn]; arn != "" && !ok {
+				unknown = append(unknown, arn)
+			}
+		}
+	}
+	for start := 0; start < len(unknown); start += 20 {
+		out, err := elb.DescribeTargetGroups(ctx, &elasticloadbalancingv2.DescribeTargetGroupsInput{
+			TargetGroupArns: unknown[start:min(start+20, len(unknown))],
+		})
+		if err != nil {
+			return fmt.Errorf("describe target groups: %w", err)
+		}
+		for _, tg := range out.TargetGroups {
+			target := cw.LoadBalancerTarget{TargetGroup: extractTargetGroupID(aws.ToString(tg.TargetGroupArn))}
+			if len(tg.LoadBalancerArns) > 0 {
+				target.LoadBalancer = extractLoadBalancerID(tg.LoadBalancerArns[0])
+			}
+			targets[aws.ToString(tg.TargetGroupArn)] = target
+		}
+	}
+
+	keys := make([]cw.ServiceKey, len(services))
+	serviceTargets := make(map[cw.ServiceKey][]cw.LoadBalancerTarget)
+	for i, svc := range services {
+		keys[i] = cw.ServiceKey{Cluster: svc.Cluster, Service: svc.Service}
+		for _, lb := range svc.LoadBalancers {
+			if target := targets[aws.ToString(lb.TargetGroupArn)]; target.LoadBalancer != "" {
+				serviceTargets[keys[i]] = append(serviceTargets[keys[i]], target)
+			}
+		}
+	}
+
+	load, err := cw.GetServiceLoad(ctx, cfg, keys, serviceTargets, opts.Window, topPeriod)
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(services, func(i, j int) bool { return services[i].Service < services[j].Service })
+
+	w := tabwriter.NewWriter(buf, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "SERVICE\tTASKS\tCPU\tMEMORY\tREQ/S\t5XX\tDEPLOYMENT")
+
+	for i, svc := range services {
+		l := load[keys[i]]
+
+		tasks := fmt.Sprintf("%d/%d", svc.RunningCount, svc.DesiredCount)
+		if svc.PendingCount > 0 {
+			tasks += fmt.Sprintf(" +%d pending", svc.PendingCount)
+		}
+
+		rps, errorRate := "-", "-"
+		if i := cw.LatestIndex(l.Requests); i >= 0 {
+			// the 5XX count of the same period, ALB publishes no datapoint when there were none
+			requests, errors := l.Requests[i], 0.0
+			if i < len(l.Errors) && !math.IsNaN(l.Errors[i]) {
+				errors = l.Errors[i]
+			}
+			rps = fmt.Sprintf("%.1f", requests/topPeriod)
+			if requests > 0 {
+				errorRate = fmt.Sprintf("%.1f%%", errors/requests*100)
+			} else {
+				errorRate = "0.0%"
+			}
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", svc.Service, tasks,
+			sparklineValue(l.CPU), sparklineValue(l.Memory), rps, errorRate, deploymentStatus(svc.Deployments))
+	}
+
+	return w.Flush()
+}
+
+func renderTopTasks(ctx context.Context, buf *bytes.Buffer, cfg aws.Config, client *awsecs.Client, opts TopOptions) error {
+	tasks, err := clusterTasks(ctx, client, opts.Cluster)
+	if err != nil {
+		return err
+	}
+
+	load, err := cw.GetTaskLoad(ctx, cfg, opts.Cluster, opts.Window, topPeriod)
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(tasks, func(i, j int) bool {
+		gi, gj := aws.ToString(tasks[i].Group), aws.ToString(tasks[j].Group)
+		if gi != gj {
+			return gi < gj
+		}
+		var mi, mj float64
+		if l := load[NameArn(aws.ToString(tasks[i].TaskArn))]; l != nil {
+			mi = l.MemoryUtilized
+		}
+		if l := load[NameArn(aws.ToString(tasks[j].TaskArn))]; l != nil {
+			mj = l.MemoryUtilized
+		}
+		return mi > mj
+	})
+
+	w := tabwriter.NewWriter(buf, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "TASK\tGROUP\tCPU\tMEMORY\tMEMORY MiB\tSTATUS")
+
+	for _, task := range tasks {
+		id := NameArn(aws.ToString(task.TaskArn))
+
+		cpu, memory, mib := "-", "-", "-"
+		if l := load[id]; l != nil {
+			cpu, memory = sparklineValue(l.CPU), sparklineValue(l.Memory)
+			mib = fmt.Sprintf("%.0f/%.0f", l.MemoryUtilized, l.MemoryReserved)
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", id, aws.ToString(task.Group), cpu, memory, mib, aws.ToString(task.LastStatus))
+	}
+
+	return w.Flush()
+}
+
+// deploymentStatus summarizes the service deployments: the rollout of the primary one and how many older
+// deployments still have tasks
+func deploymentStatus(deployments []ectypes.Deployment) string {
+	var primary *ectypes.Deployment
+	older := 0
+	for i, d := range deployments {
+		if aws.ToString(d.Status) == "PRIMARY" {
+			primary = &deployments[i]
+		} else if d.RunningCount > 0 || d.PendingCount > 0 {
+			older++
+		}
+	}
+	if primary == nil {
+		return "-"
+	}
+
+	state := string(primary.RolloutState)
+	if state == "" {
+		state = "COMPLETED"
+		if older > 0 {
+			state = "IN_PROGRESS"
+		}
+	}
+
+	status := fmt.Sprintf("%s %s", NameArn(aws.ToString(primary.TaskDefinition)), state)
+	if state != "COMPLETED" {
+		status += fmt.Sprintf(" %d/%d", primary.RunningCount, primary.DesiredCount)
+	}
+	if older > 0 {
+		status += fmt.Sprintf(", %d old", older)
+	}
+	if primary.FailedTasks > 0 {
+		status += fmt.Sprintf(", %d failed tasks", primary.FailedTasks)
+	}
+	return status
+}
+
+var sparkChars = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline renders percentages (0-100) as block characters, blank where there is no data
+func sparkline(values []float64) string {
+	var sb strings.Builder
+	for _, v := range values {
+		if math.IsNaN(v) {
+			sb.WriteRune(' ')
+			continue
+		}
+		i := int(v / 100 * float64(len(sparkChars)-1))
+		sb.WriteRune(sparkChars[max(0, min(i, len(sparkChars)-1))])
+	}
+	return sb.String()
+}
+
+// sparklineValue is the sparkline followed by the latest value
+func sparklineValue(values []float64) string {
+	latest, ok := cw.Latest(values)
+	if !ok {
+		return sparkline(values) + "     -"
+	}
+	return fmt.Sprintf("%s %5.1f%%", sparkline(values), latest)
+}
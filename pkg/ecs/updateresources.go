@@ -0,0 +1,255 @@
+package ecs
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	awsecs "github.com/aws/aws-sdk-go-v2/service/ecs"
+	ectypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/spf13/cobra"
+)
+
+type ResourcesOptions struct {
+	Cluster           string
+	Service           string
+	Cpu               int
+	Memory            int
+	ContainerName     string // optional; when empty, index 0 is used
+	ContainerCpu      int
+	ContainerMemory   int
+	MemoryReservation int
+	Wait              bool
+	Timeout           time.Duration
+}
+
+// fargateMemory maps each Fargate task CPU size to its allowed memory values (MiB)
+var fargateMemory = map[int][]int{
+	256:   {512, 1024, 2048},
+	512:   memoryRange(1024, 4096, 1024),
+	1024:  memoryRange(2048, 8192, 1024),
+	2048:  memoryRange(4096, 16384, 1024),
+	4096:  memoryRange(8192, 30720, 1024),
+	8192:  memoryRange(16384, 61440, 4096),
+	16384: memoryRange(32768, 122880, 8192),
+}
+
+func memoryRange(min, max, step int) []int {
+	var values []int
+	for m := min; m <= max; m += step {
+		values = append(values, m)
+	}
+	return values
+}
+
+// SetResources returns the `nami set resources` command
+func SetResources() *cobra.Command {
+	var (
+		cluster           string
+		cpu               int
+		memory            int
+		containerName     string
+		containerCpu      int
+		containerMemory   int
+		memoryReservation int
+		wait              bool
+		timeoutSec        int
+	)
+
+	cmd := &cobra.Command{
+		Use:     "resources [service]",
+		Aliases: []string{"resource", "res"},
+		Short:   "Resize task and container CPU/memory",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts := ResourcesOptions{
+				Cluster:           cluster,
+				Service:           args[0],
+				Cpu:               cpu,
+				Memory:            memory,
+				ContainerName:     containerName,
+				ContainerCpu:      containerCpu,
+				ContainerMemory:   containerMemory,
+				MemoryReservation: memoryReservation,
+				Wait:              wait,
+				Timeout:           time.Duration(timeoutSec) * time.Second,
+			}
+
+			tdArn, err := updateServiceResources(cmd.Context(), opts)
+			if err != nil {
+				return err
+			}
+
+			fmt.Println(tdArn)
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVarP(&cluster, "cluster", "c", "", "ECS Cluster name")
+	cmd.MarkFlagRequired("cluster")
+	cmd.Flags().IntVar(&cpu, "cpu", 0, "Task CPU units (e.g. 256, 512, 1024)")
+	cmd.Flags().IntVar(&memory, "memory", 0, "Task memory in MiB")
+	cmd.Flags().StringVar(&containerName, "container-name", "", "Container to resize (default first container)")
+	cmd.Flags().IntVar(&containerCpu, "container-cpu", 0, "Container CPU units")
+	cmd.Flags().IntVar(&containerMemory, "container-memory", 0, "Container hard memory limit in MiB")
+	cmd.Flags().IntVar(&memoryReservation, "memory-reservation", 0, "Container soft memory limit in MiB")
+	cmd.Flags().BoolVar(&wait, "wait", false, "Wait until service reaches steady state")
+	cmd.Flags().IntVar(&timeoutSec, "timeout", 300, "Timeout in seconds for wait")
+
+	return cmd
+}
+
+func updateServiceResources(ctx context.Context, opts ResourcesOptions) (string, error) {
+	if opts.Cpu == 0 && opts.Memory == 0 && opts.ContainerCpu == 0 && opts.ContainerMemory == 0 && opts.MemoryReservation == 0 {
+		return "", fmt.Errorf("nothing to change: set --cpu, --memory, --container-cpu, --container-memory or --memory-reservation")
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return "", fmt.Errorf("loading AWS config: %w", err)
+	}
+
+	client := awsecs.NewFromConfig(cfg)
+
+	_, td, err := describeServiceTaskDefinition(ctx, client, opts.Cluster, opts.Service)
+	if err != nil {
+		return "", err
+	}
+	currentTDArn := aws.ToString(td.TaskDefinitionArn)
+
+	containers := make([]ectypes.ContainerDefinition, len(td.ContainerDefinitions))
+	copy(containers, td.ContainerDefinitions)
+
+	if len(containers) == 0 {
+		return "", fmt.Errorf("task definition %q has no container definitions", currentTDArn)
+	}
+
+	if opts.ContainerCpu != 0 || opts.ContainerMemory != 0 || opts.MemoryReservation != 0 {
+		idx := 0
+		if opts.ContainerName != "" {
+			idx = -1
+			for i, c := range containers {
+				if aws.ToString(c.Name) == opts.ContainerName {
+					idx = i
+					break
+				}
+			}
+			if idx < 0 {
+				return "", fmt.Errorf("container %q not found in task definition %q", opts.ContainerName, currentTDArn)
+			}
+		}
+
+		if opts.ContainerCpu != 0 {
+			containers[idx].Cpu = int32(opts.ContainerCpu)
+		}
+		if opts.ContainerMemory != 0 {
+			containers[idx].Memory = aws.Int32(int32(opts.ContainerMemory))
+		}
+		if opts.MemoryReservation != 0 {
+			containers[idx].MemoryReservation = aws.Int32(int32(opts.MemoryReservation))
+		}
+	}
+
+	clone := *td
+	if opts.Cpu != 0 {
+		clone.Cpu = aws.String(strconv.Itoa(opts.Cpu))
+	}
+	if opts.Memory != 0 {
+		clone.Memory = aws.String(strconv.Itoa(opts.Memory))
+	}
+
+	if err := validateTaskResources(&clone, containers); err != nil {
+		return "", err
+	}
+
+	newTDArn, err := registerTaskDefinitionRevision(ctx, client, &clone, containers)
+	if err != nil {
+		return "", err
+	}
+
+	if err := rolloutTaskDefinition(ctx, client, opts.Cluster, opts.Service, newTDArn, opts.Wait, opts.Timeout); err != nil {
+		return "", err
+	}
+
+	return newTDArn, nil
+}
+
+// validateTaskResources checks the task size against Fargate limits and the container sizes against the task size
+func validateTaskResources(td *ectypes.TaskDefinition, containers []ectypes.ContainerDefinition) error {
+	var taskCpu, taskMemory int
+	var err error
+
+	if td.Cpu != nil {
+		if taskCpu, err = strconv.Atoi(aws.ToString(td.Cpu)); err != nil {
+			return fmt.Errorf("invalid task cpu %q", aws.ToString(td.Cpu))
+		}
+	}
+	if td.Memory != nil {
+		if taskMemory, err = strconv.Atoi(aws.ToString(td.Memory)); err != nil {
+			return fmt.Errorf("invalid task memory %q", aws.ToString(td.Memory))
+		}
+	}
+
+	fargate := false
+	for _, c := range td.RequiresCompatibilities {
+		if c == ectypes.CompatibilityFargate {
+			fargate = true
+		}
+	}
+
+	if fargate {
+		if err := validateFargateSize(taskCpu, taskMemory); err != nil {
+			return err
+		}
+	}
+
+	var sumCpu, sumMemory int
+	for _, c := range containers {
+		name := aws.ToString(c.Name)
+		hard := int(aws.ToInt32(c.Memory))
+		soft := int(aws.ToInt32(c.MemoryReservation))
+
+		if hard != 0 && soft > hard {
+			return fmt.Errorf("container %q: memory reservation %d MiB exceeds memory limit %d MiB", name, soft, hard)
+		}
+
+		sumCpu += int(c.Cpu)
+		if hard != 0 {
+			sumMemory += hard
+		} else {
+			sumMemory += soft
+		}
+	}
+
+	if taskCpu != 0 && sumCpu > taskCpu {
+		return fmt.Errorf("containers reserve %d CPU units but the task only has %d", sumCpu, taskCpu)
+	}
+	if taskMemory != 0 && sumMemory > taskMemory {
+		return fmt.Errorf("containers reserve %d MiB but the task only has %d MiB", sumMemory, taskMemory)
+	}
+
+	return nil
+}
+
+func validateFargateSize(cpu, memory int) error {
+	allowed, ok := fargateMemory[cpu]
+	if !ok {
+		return fmt.Errorf("invalid Fargate task cpu %d: must be one of 256, 512, 1024, 2048, 4096, 8192, 16384", cpu)
+	}
+
+	for _, m := range allowed {
+		if m == memory {
+			return nil
+		}
+	}
+
+	if len(allowed) > 3 {
+		return fmt.Errorf("invalid Fargate memory %d MiB for cpu %d: must be between %d and %d MiB in %d MiB increments",
+			memory, cpu, allowed[0], allowed[len(allowed)-1], allowed[1]-allowed[0])
+	}
+	return fmt.Errorf("invalid Fargate memory %d MiB for cpu %d: must be one of %v", memory, cpu, allowed)
+}
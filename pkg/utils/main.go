@@ -1,7 +1,12 @@
 package utils
 
 import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // GetResourceName extracts the resource name from an AWS ARN
@@ -73,3 +78,101 @@ func FormatServiceName(serviceName string) string {
 	// Remove any trailing whitespace
 	return strings.TrimSpace(serviceName)
 }
+
+// ParseDuration parses a duration like time.ParseDuration, additionally accepting days
+// Examples:
+// - 15m -> 15 minutes
+// - 24h -> 24 hours
+// - 7d -> 168 hours
+func ParseDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.ParseFloat(strings.TrimSuffix(s, "d"), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(days * float64(24*time.Hour)), nil
+	}
+
+	return time.ParseDuration(s)
+}
+
+// Confirm prints prompt and reads a line from stdin, reporting whether it matches expected
+// Examples:
+// - Confirm("Type the cluster name to confirm: ", "prod") -> true when the user types prod
+// - Confirm("Continue? [y/N] ", "y") -> true when the user types y
+func Confirm(prompt, expected string) bool {
+	fmt.Print(prompt)
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return false
+	}
+
+	return strings.TrimSpace(line) == expected
+}
+
+// SplitArgs splits a command line into arguments the way a POSIX shell does, honoring single quotes,
+// double quotes and backslash escapes, without expanding variables or globs
+// Examples:
+// - python manage.py migrate -> [python manage.py migrate]
+// - sh -c 'echo "a b"' -> [sh -c echo "a b"]
+// - echo a\ b -> [echo a b]
+func SplitArgs(s string) ([]string, error) {
+	var (
+		args    []string
+		current strings.Builder
+		inArg   bool
+		quote   rune
+		escaped bool
+	)
+
+	for _, r := range s {
+		switch {
+		case escaped:
+			// Inside double quotes a backslash only escapes characters the shell treats specially
+			if quote == '"' && !strings.ContainsRune(`"\$`+"`", r) {
+				current.WriteRune('\\')
+			}
+			current.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\\':
+			escaped, inArg = true, true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if escaped {
+		return nil, fmt.Errorf("invalid command %q: trailing backslash", s)
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("invalid command %q: unterminated %c quote", s, quote)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+
+	return args, nil
+}
@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []string
+		wantErr bool
+	}{
+		{in: "python manage.py migrate", want: []string{"python", "manage.py", "migrate"}},
+		{in: "  ls   -la\t/tmp\n", want: []string{"ls", "-la", "/tmp"}},
+		{in: `sh -c 'echo "a b"'`, want: []string{"sh", "-c", `echo "a b"`}},
+		{in: `echo "it's" 'a\b'`, want: []string{"echo", "it's", `a\b`}},
+		{in: `echo a\ b`, want: []string{"echo", "a b"}},
+		{in: `echo "a \"b\" \$c \d"`, want: []string{"echo", `a "b" $c \d`}},
+		{in: `echo '' ""`, want: []string{"echo", "", ""}},
+		{in: `a"b c"d`, want: []string{"ab cd"}},
+		{in: "", want: nil},
+		{in: `echo "unterminated`, wantErr: true},
+		{in: `echo 'unterminated`, wantErr: true},
+		{in: `echo trailing\`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := SplitArgs(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("SplitArgs(%q) = %q, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("SplitArgs(%q) returned error: %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitArgs(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{in: "15m", want: 15 * time.Minute},
+		{in: "24h", want: 24 * time.Hour},
+		{in: "1h30m", want: 90 * time.Minute},
+		{in: "7d", want: 7 * 24 * time.Hour},
+		{in: "1.5d", want: 36 * time.Hour},
+		{in: " 2d ", want: 48 * time.Hour},
+		{in: "d", wantErr: true},
+		{in: "xd", wantErr: true},
+		{in: "10", wantErr: true},
+		{in: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseDuration(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseDuration(%q) = %s, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseDuration(%q) returned error: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseDuration(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}